@@ -22,13 +22,21 @@ import (
 
 	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/cmd/cpvpa/options"
 	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/autoscaler"
+	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/controller"
 	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/version"
+	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/webhook"
 
 	"github.com/golang/glog"
 	"github.com/spf13/pflag"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if run, found := subcommands[os.Args[1]]; found {
+			os.Exit(run(os.Args[2:]))
+		}
+	}
+
 	config := options.NewAutoScalerConfig()
 	config.AddFlags(pflag.CommandLine)
 	config.InitFlags()
@@ -43,12 +51,43 @@ func main() {
 		os.Exit(1)
 	}
 
-	glog.V(0).Infof("Scaling namespace: %s, target: %s", config.Namespace, config.Target)
+	if config.WebhookAddress != "" {
+		server, err := webhook.NewServer(config)
+		if err != nil {
+			glog.Errorf("%v", err)
+			os.Exit(1)
+		}
+		serveHTTP(config.HTTPAddress, func() error { return nil })
+		if err := server.Run(config.WebhookAddress, config.TLSCertFile, config.TLSPrivateKeyFile); err != nil {
+			glog.Errorf("Failed to serve admission webhook: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if config.Controller {
+		glog.V(0).Infof("Reconciling ProportionalVerticalScalers in all namespaces")
+		ctrl, err := controller.NewController(config)
+		if err != nil {
+			glog.Errorf("%v", err)
+			os.Exit(1)
+		}
+		serveHTTP(config.HTTPAddress, func() error { return nil })
+		ctrl.Run()
+		return
+	}
+
+	if config.TargetSelector != "" {
+		glog.V(0).Infof("Scaling namespace: %s, target selector: %s, all namespaces: %t", config.Namespace, config.TargetSelector, config.AllNamespaces)
+	} else {
+		glog.V(0).Infof("Scaling namespace: %s, target: %s", config.Namespace, config.Target)
+	}
 	scaler, err := autoscaler.NewAutoScaler(config)
 	if err != nil {
 		glog.Errorf("%v", err)
 		os.Exit(1)
 	}
+	serveHTTP(config.HTTPAddress, scaler.Ready)
 	// Begin autoscaling.
 	scaler.Run()
 }
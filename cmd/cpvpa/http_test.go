@@ -0,0 +1,52 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	var readyErr error
+	handler := newHTTPHandler(func() error { return readyErr })
+
+	for _, tc := range []struct {
+		path     string
+		readyErr error
+		expCode  int
+		expBody  string
+	}{
+		{"/healthz", errors.New("invalid config"), http.StatusOK, "ok"},
+		{"/readyz", nil, http.StatusOK, "ok"},
+		{"/readyz", errors.New("invalid config"), http.StatusServiceUnavailable, "invalid config"},
+		{"/metrics", nil, http.StatusOK, "cpvpa_config_last_reload_successful"},
+	} {
+		readyErr = tc.readyErr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", tc.path, nil))
+		if rec.Code != tc.expCode {
+			t.Errorf("%s: expected status %d, got %d", tc.path, tc.expCode, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), tc.expBody) {
+			t.Errorf("%s: expected body to contain %q, got %q", tc.path, tc.expBody, rec.Body.String())
+		}
+	}
+}
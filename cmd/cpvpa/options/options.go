@@ -22,21 +22,50 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+)
+
+// How resources which conflict with the LimitRanges and ResourceQuotas of the
+// namespace of a target are handled.
+const (
+	NamespacePolicyIgnore = "ignore"
+	NamespacePolicyClamp  = "clamp"
+	NamespacePolicyRefuse = "refuse"
 )
 
 // AutoScalerConfig configures and runs an autoscaler server
 type AutoScalerConfig struct {
 	Namespace         string
 	Target            string
+	TargetSelector    string
+	AllNamespaces     bool
+	AnnotatedTargets  bool
+	Controller        bool
 	DefaultConfig     string
-	ConfigFile        string
+	ConfigFiles       []string
+	ConfigMap         string
+	ConfigOverlay     string
 	PollPeriodSeconds int
+	HTTPAddress       string
 	Kubeconfig        string
 	PrintVer          bool
 	DryRun            bool
+
+	RemoveUnconfiguredResources bool
+	NamespacePolicy             string
+	RolloutDeadline             time.Duration
+	UpdateCooldown              time.Duration
+
+	// Set to serve a mutating admission webhook instead of scaling targets.
+	WebhookAddress    string
+	TLSCertFile       string
+	TLSPrivateKeyFile string
 }
 
 // NewAutoScalerConfig returns a Autoscaler config
@@ -45,6 +74,7 @@ func NewAutoScalerConfig() *AutoScalerConfig {
 		// Defaults.
 		Namespace:         os.Getenv("MY_NAMESPACE"),
 		PollPeriodSeconds: 10,
+		NamespacePolicy:   NamespacePolicyIgnore,
 		PrintVer:          false,
 		DryRun:            false,
 	}
@@ -53,12 +83,26 @@ func NewAutoScalerConfig() *AutoScalerConfig {
 // AddFlags adds flags to the specified FlagSet.
 func (c *AutoScalerConfig) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&c.Target, "target", c.Target, "The target object to scale. Format: deployment/* (not case sensitive).")
+	fs.StringVar(&c.TargetSelector, "target-selector", c.TargetSelector, "Scale every object of a kind which matches a label selector, instead of a single --target. Format: deployment/<selector> (kind is not case sensitive).")
 	fs.StringVar(&c.Namespace, "namespace", c.Namespace, "The Namespace of the --target. Defaults to ${MY_NAMESPACE}.")
-	fs.StringVar(&c.DefaultConfig, "default-config", c.DefaultConfig, "The default configuration (in JSON format).")
-	fs.StringVar(&c.ConfigFile, "config-file", c.ConfigFile, "A config file (in JSON format), which overrides the --default-config.")
+	fs.BoolVar(&c.AllNamespaces, "all-namespaces", c.AllNamespaces, "Match the --target-selector in all namespaces, instead of just --namespace.")
+	fs.BoolVar(&c.AnnotatedTargets, "annotated-targets", c.AnnotatedTargets, "Scale every deployment, daemonset and replicaset in the cluster which has a cpvpa.k8s.io/config annotation, using the annotation (in JSON or YAML format) as its config.")
+	fs.BoolVar(&c.Controller, "controller", c.Controller, "Reconcile the ProportionalVerticalScaler objects in all namespaces, instead of scaling a single --target.")
+	fs.StringVar(&c.DefaultConfig, "default-config", c.DefaultConfig, "The default configuration (in JSON or YAML format).")
+	fs.StringSliceVar(&c.ConfigFiles, "config-file", c.ConfigFiles, "Config files (in JSON or YAML format), or directories of them, which are merged in order over the --default-config. May be repeated or comma-separated.")
+	fs.StringVar(&c.ConfigMap, "configmap", c.ConfigMap, "A ConfigMap key holding a config (in JSON or YAML format), which is watched through the API and overrides the --default-config. Format: <namespace>/<name>:<key>.")
+	fs.StringVar(&c.ConfigOverlay, "config-overlay", c.ConfigOverlay, "A config file (in JSON or YAML format) for this cluster, which is merged over the --config-file or --configmap.")
 	fs.IntVar(&c.PollPeriodSeconds, "poll-period-seconds", c.PollPeriodSeconds, "The period, in seconds, to poll cluster size and perform autoscaling.")
+	fs.StringVar(&c.HTTPAddress, "http-address", c.HTTPAddress, "The address to serve /metrics, /healthz and /readyz on, such as :8080. Not served if empty.")
+	fs.StringVar(&c.WebhookAddress, "webhook-address", c.WebhookAddress, "Serve a mutating admission webhook on this address, such as :8443, which sets the resources of each DaemonSet pod from the size of the node it is scheduled to, instead of scaling a --target.")
+	fs.StringVar(&c.TLSCertFile, "tls-cert-file", c.TLSCertFile, "The TLS certificate of the --webhook-address.")
+	fs.StringVar(&c.TLSPrivateKeyFile, "tls-private-key-file", c.TLSPrivateKeyFile, "The TLS private key of the --webhook-address.")
 	fs.StringVar(&c.Kubeconfig, "kubeconfig", c.Kubeconfig, "Path to a kubeconfig. Only required if running out-of-cluster.")
 	fs.BoolVar(&c.PrintVer, "version", c.PrintVer, "Print the version and exit.")
+	fs.BoolVar(&c.RemoveUnconfiguredResources, "remove-unconfigured-resources", c.RemoveUnconfiguredResources, "Remove the requests and limits which were set by the autoscaler, but are no longer in the config. The resources set on each target are recorded in its cpvpa.k8s.io/managed-resources annotation.")
+	fs.StringVar(&c.NamespacePolicy, "namespace-policy", c.NamespacePolicy, "How to handle resources which conflict with the LimitRanges or ResourceQuotas of the namespace of a target: ignore, clamp (to the min and max of each LimitRange) or refuse. Updates which would exceed a ResourceQuota are refused unless this is ignore.")
+	fs.DurationVar(&c.RolloutDeadline, "rollout-deadline", c.RolloutDeadline, "Revert the resources of a target, and record an Event, if its rollout has not completed this long after they were updated, such as 10m. The rollout is not watched if 0.")
+	fs.DurationVar(&c.UpdateCooldown, "update-cooldown", c.UpdateCooldown, "The minimum time between updates of a target, such as 30m. Only the latest resources computed in the meantime are applied once it has passed. Targets are updated on every change if 0.")
 	fs.BoolVar(&c.DryRun, "dry-run", c.PrintVer, "Calulate updates for a target but does not apply the update.")
 }
 
@@ -81,17 +125,98 @@ func (c *AutoScalerConfig) InitFlags() {
 func (c *AutoScalerConfig) ValidateFlags() error {
 	var errorsFound bool
 
-	c.Target = strings.ToLower(c.Target)
-	if !isTargetFormatValid(c.Target) {
+	switch {
+	case c.WebhookAddress != "":
+		if c.Controller || c.AnnotatedTargets || c.Target != "" || c.TargetSelector != "" {
+			errorsFound = true
+			glog.Errorf("--webhook-address cannot be used with --controller, --annotated-targets, --target or --target-selector")
+		}
+		if c.ConfigMap != "" {
+			errorsFound = true
+			glog.Errorf("--webhook-address cannot be used with --configmap")
+		}
+		// These only apply to updates of targets, which the webhook does not
+		// make.  With --dry-run, the webhook would still mutate pods.
+		if (c.NamespacePolicy != "" && c.NamespacePolicy != NamespacePolicyIgnore) || c.RemoveUnconfiguredResources || c.DryRun {
+			errorsFound = true
+			glog.Errorf("--webhook-address cannot be used with --namespace-policy, --remove-unconfigured-resources or --dry-run")
+		}
+		if c.TLSCertFile == "" || c.TLSPrivateKeyFile == "" {
+			errorsFound = true
+			glog.Errorf("--webhook-address needs --tls-cert-file and --tls-private-key-file")
+		}
+	case c.Controller && c.AnnotatedTargets:
+		errorsFound = true
+		glog.Errorf("Only one of --controller or --annotated-targets may be specified")
+	case c.Controller || c.AnnotatedTargets:
+		mode := "--annotated-targets"
+		if c.Controller {
+			mode = "--controller"
+		}
+		if c.Target != "" || c.TargetSelector != "" {
+			errorsFound = true
+			glog.Errorf("%s cannot be used with --target or --target-selector", mode)
+		}
+		if c.DefaultConfig != "" || len(c.ConfigFiles) > 0 || c.ConfigMap != "" || c.ConfigOverlay != "" {
+			errorsFound = true
+			glog.Errorf("%s cannot be used with --default-config, --config-file, --configmap or --config-overlay", mode)
+		}
+	case c.Target != "" && c.TargetSelector != "":
+		errorsFound = true
+		glog.Errorf("Only one of --target or --target-selector may be specified")
+	case c.TargetSelector != "":
+		if !isTargetSelectorFormatValid(c.TargetSelector) {
+			errorsFound = true
+		}
+	default:
+		c.Target = strings.ToLower(c.Target)
+		if !isTargetFormatValid(c.Target) {
+			errorsFound = true
+		}
+	}
+	if c.AllNamespaces && c.TargetSelector == "" {
 		errorsFound = true
+		glog.Errorf("--all-namespaces can only be used with --target-selector")
 	}
-	if c.Namespace == "" {
+	if c.Namespace == "" && !c.AllNamespaces && !c.AnnotatedTargets && !c.Controller && c.WebhookAddress == "" {
 		errorsFound = true
 		glog.Errorf("--namespace parameter not set and failed to fallback")
 	}
-	if c.DefaultConfig == "" && c.ConfigFile == "" {
+	if c.DefaultConfig == "" && len(c.ConfigFiles) == 0 && c.ConfigMap == "" && !c.AnnotatedTargets && !c.Controller {
 		errorsFound = true
-		glog.Errorf("Either --default-config or --config-file must be specified")
+		glog.Errorf("Either --default-config, --config-file or --configmap must be specified")
+	}
+	if len(c.ConfigFiles) > 0 && c.ConfigMap != "" {
+		errorsFound = true
+		glog.Errorf("Only one of --config-file or --configmap may be specified")
+	}
+	if c.ConfigMap != "" {
+		if _, _, _, err := ParseConfigMap(c.ConfigMap); err != nil {
+			errorsFound = true
+			glog.Errorf("Invalid --configmap: %v", err)
+		}
+	}
+	switch c.NamespacePolicy {
+	case "", NamespacePolicyIgnore, NamespacePolicyClamp, NamespacePolicyRefuse:
+	default:
+		errorsFound = true
+		glog.Errorf("--namespace-policy must be one of %s, %s or %s", NamespacePolicyIgnore, NamespacePolicyClamp, NamespacePolicyRefuse)
+	}
+	for _, d := range []struct {
+		flag  string
+		value time.Duration
+	}{
+		{"--rollout-deadline", c.RolloutDeadline},
+		{"--update-cooldown", c.UpdateCooldown},
+	} {
+		if d.value < 0 {
+			errorsFound = true
+			glog.Errorf("%s cannot be negative", d.flag)
+		}
+		if d.value > 0 && (c.Controller || c.WebhookAddress != "") {
+			errorsFound = true
+			glog.Errorf("%s cannot be used with --controller or --webhook-address", d.flag)
+		}
 	}
 	if c.PollPeriodSeconds < 1 {
 		errorsFound = true
@@ -105,6 +230,23 @@ func (c *AutoScalerConfig) ValidateFlags() error {
 	return nil
 }
 
+// K8sClientOptions returns the options of the client which reaches the
+// apiserver.
+func (c *AutoScalerConfig) K8sClientOptions() k8sclient.Options {
+	return k8sclient.Options{
+		Kubeconfig:         c.Kubeconfig,
+		Namespace:          c.Namespace,
+		Target:             c.Target,
+		TargetSelector:     c.TargetSelector,
+		AllNamespaces:      c.AllNamespaces,
+		AnnotatedTargets:   c.AnnotatedTargets,
+		Controller:         c.Controller,
+		DryRun:             c.DryRun,
+		RemoveUnconfigured: c.RemoveUnconfiguredResources,
+		RecordLastUpdated:  c.UpdateCooldown > 0,
+	}
+}
+
 func isTargetFormatValid(target string) bool {
 	if target == "" {
 		glog.Errorf("--target parameter cannot be empty")
@@ -121,3 +263,36 @@ func isTargetFormatValid(target string) bool {
 	glog.Errorf("Unknown target format: must be one of deployment/*, daemonset/*, or replicaset/* (not case sensitive).")
 	return false
 }
+
+func isTargetSelectorFormatValid(targetSelector string) bool {
+	splits := strings.SplitN(targetSelector, "/", 2)
+	if len(splits) != 2 {
+		glog.Errorf("Unknown target selector format: must be one of deployment/<selector>, daemonset/<selector>, or replicaset/<selector>.")
+		return false
+	}
+	if !isTargetFormatValid(strings.ToLower(splits[0]) + "/") {
+		return false
+	}
+	if splits[1] == "" {
+		glog.Errorf("--target-selector label selector cannot be empty")
+		return false
+	}
+	if _, err := labels.Parse(splits[1]); err != nil {
+		glog.Errorf("Invalid --target-selector label selector %q: %v", splits[1], err)
+		return false
+	}
+	return true
+}
+
+// ParseConfigMap splits a --configmap value into its namespace, name and key.
+func ParseConfigMap(configMap string) (namespace, name, key string, err error) {
+	ref, key, found := strings.Cut(configMap, ":")
+	if !found || key == "" {
+		return "", "", "", fmt.Errorf("%q is missing a key: must be <namespace>/<name>:<key>", configMap)
+	}
+	namespace, name, found = strings.Cut(ref, "/")
+	if !found || namespace == "" || name == "" {
+		return "", "", "", fmt.Errorf("%q is missing a namespace or name: must be <namespace>/<name>:<key>", configMap)
+	}
+	return namespace, name, key, nil
+}
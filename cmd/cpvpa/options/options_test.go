@@ -19,6 +19,7 @@ package options
 import (
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestIsTargetFormatValid(t *testing.T) {
@@ -76,3 +77,217 @@ func TestIsTargetFormatValid(t *testing.T) {
 		}
 	}
 }
+
+func TestIsTargetSelectorFormatValid(t *testing.T) {
+	testCases := []struct {
+		targetSelector string
+		expResult      bool
+	}{
+		{
+			"deployment/app=thing",
+			true,
+		},
+		{
+			"DaemonSet/app.kubernetes.io/part-of=tenants,tier!=test",
+			true,
+		},
+		{
+			"replicaset/env in (prod, staging)",
+			true,
+		},
+		{
+			"deployment/",
+			false,
+		},
+		{
+			"deployment",
+			false,
+		},
+		{
+			"replicationcontroller/app=thing",
+			false,
+		},
+		{
+			"deployment/=thing",
+			false,
+		},
+	}
+
+	for _, tc := range testCases {
+		res := isTargetSelectorFormatValid(tc.targetSelector)
+		if res != tc.expResult {
+			t.Errorf("Target selector format verification for [%v] failed. Expected %v, Got %v", tc.targetSelector, tc.expResult, res)
+		}
+	}
+}
+
+func TestValidateFlagsTargets(t *testing.T) {
+	testCases := []struct {
+		name           string
+		target         string
+		targetSelector string
+		namespace      string
+		allNamespaces  bool
+		annotated      bool
+		expError       bool
+	}{
+		{"target", "deployment/thing", "", "default", false, false, false},
+		{"selector", "", "deployment/app=thing", "default", false, false, false},
+		{"selector in all namespaces", "", "deployment/app=thing", "", true, false, false},
+		{"target and selector", "deployment/thing", "deployment/app=thing", "default", false, false, true},
+		{"neither", "", "", "default", false, false, true},
+		{"target in all namespaces", "deployment/thing", "", "default", true, false, true},
+		{"no namespace", "", "deployment/app=thing", "", false, false, true},
+		{"annotated", "", "", "", false, true, false},
+		{"annotated and target", "deployment/thing", "", "", false, true, true},
+	}
+
+	for _, tc := range testCases {
+		c := &AutoScalerConfig{
+			Target:            tc.target,
+			TargetSelector:    tc.targetSelector,
+			Namespace:         tc.namespace,
+			AllNamespaces:     tc.allNamespaces,
+			AnnotatedTargets:  tc.annotated,
+			PollPeriodSeconds: 10,
+		}
+		if !tc.annotated {
+			c.DefaultConfig = "{}"
+		}
+		err := c.ValidateFlags()
+		if err != nil && !tc.expError {
+			t.Errorf("%s: expected no error, got %v", tc.name, err)
+		} else if err == nil && tc.expError {
+			t.Errorf("%s: expected error, got none", tc.name)
+		}
+	}
+}
+
+func TestValidateFlagsController(t *testing.T) {
+	c := &AutoScalerConfig{Controller: true, PollPeriodSeconds: 10}
+	if err := c.ValidateFlags(); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+
+	c = &AutoScalerConfig{Controller: true, DefaultConfig: "{}", PollPeriodSeconds: 10}
+	if err := c.ValidateFlags(); err == nil {
+		t.Errorf("expected error for --controller with --default-config, got none")
+	}
+
+	c = &AutoScalerConfig{Controller: true, AnnotatedTargets: true, PollPeriodSeconds: 10}
+	if err := c.ValidateFlags(); err == nil {
+		t.Errorf("expected error for --controller with --annotated-targets, got none")
+	}
+}
+
+func TestValidateFlagsNamespacePolicy(t *testing.T) {
+	for _, tc := range []struct {
+		policy   string
+		expError bool
+	}{
+		{"", false},
+		{NamespacePolicyIgnore, false},
+		{NamespacePolicyClamp, false},
+		{NamespacePolicyRefuse, false},
+		{"Clamp", true},
+	} {
+		c := &AutoScalerConfig{Target: "deployment/thing", Namespace: "default", DefaultConfig: "{}", PollPeriodSeconds: 10, NamespacePolicy: tc.policy}
+		err := c.ValidateFlags()
+		if err != nil && !tc.expError {
+			t.Errorf("%q: expected no error, got %v", tc.policy, err)
+		} else if err == nil && tc.expError {
+			t.Errorf("%q: expected error, got none", tc.policy)
+		}
+	}
+}
+
+func TestValidateFlagsDurations(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		config   AutoScalerConfig
+		expError bool
+	}{
+		{"target", AutoScalerConfig{Target: "deployment/thing", Namespace: "default", DefaultConfig: "{}", RolloutDeadline: 10 * time.Minute}, false},
+		{"annotated targets", AutoScalerConfig{AnnotatedTargets: true, RolloutDeadline: 10 * time.Minute}, false},
+		{"negative", AutoScalerConfig{Target: "deployment/thing", Namespace: "default", DefaultConfig: "{}", RolloutDeadline: -time.Minute}, true},
+		{"controller", AutoScalerConfig{Controller: true, RolloutDeadline: 10 * time.Minute}, true},
+		{"cooldown", AutoScalerConfig{Target: "deployment/thing", Namespace: "default", DefaultConfig: "{}", UpdateCooldown: 30 * time.Minute}, false},
+		{"negative cooldown", AutoScalerConfig{Target: "deployment/thing", Namespace: "default", DefaultConfig: "{}", UpdateCooldown: -time.Minute}, true},
+		{"controller cooldown", AutoScalerConfig{Controller: true, UpdateCooldown: 30 * time.Minute}, true},
+	} {
+		c := tc.config
+		c.PollPeriodSeconds = 10
+		err := c.ValidateFlags()
+		if err != nil && !tc.expError {
+			t.Errorf("%s: expected no error, got %v", tc.name, err)
+		} else if err == nil && tc.expError {
+			t.Errorf("%s: expected error, got none", tc.name)
+		}
+	}
+}
+
+func TestValidateFlagsWebhook(t *testing.T) {
+	testCases := []struct {
+		name     string
+		config   AutoScalerConfig
+		noTLS    bool
+		expError bool
+	}{
+		{"webhook", AutoScalerConfig{DefaultConfig: "{}"}, false, false},
+		{"config file", AutoScalerConfig{ConfigFiles: []string{"config.yaml"}}, false, false},
+		{"no config", AutoScalerConfig{}, false, true},
+		{"no tls", AutoScalerConfig{DefaultConfig: "{}"}, true, true},
+		{"target", AutoScalerConfig{DefaultConfig: "{}", Target: "daemonset/thing"}, false, true},
+		{"controller", AutoScalerConfig{Controller: true}, false, true},
+		{"configmap", AutoScalerConfig{ConfigMap: "kube-system/thing:config"}, false, true},
+		{"namespace policy ignore", AutoScalerConfig{DefaultConfig: "{}", NamespacePolicy: NamespacePolicyIgnore}, false, false},
+		{"namespace policy", AutoScalerConfig{DefaultConfig: "{}", NamespacePolicy: NamespacePolicyClamp}, false, true},
+		{"remove unconfigured", AutoScalerConfig{DefaultConfig: "{}", RemoveUnconfiguredResources: true}, false, true},
+		{"dry run", AutoScalerConfig{DefaultConfig: "{}", DryRun: true}, false, true},
+	}
+
+	for _, tc := range testCases {
+		c := tc.config
+		c.WebhookAddress = ":8443"
+		c.PollPeriodSeconds = 10
+		if !tc.noTLS {
+			c.TLSCertFile = "tls.crt"
+			c.TLSPrivateKeyFile = "tls.key"
+		}
+		err := c.ValidateFlags()
+		if err != nil && !tc.expError {
+			t.Errorf("%s: expected no error, got %v", tc.name, err)
+		} else if err == nil && tc.expError {
+			t.Errorf("%s: expected error, got none", tc.name)
+		}
+	}
+}
+
+func TestParseConfigMap(t *testing.T) {
+	testCases := []struct {
+		configMap    string
+		expNamespace string
+		expName      string
+		expKey       string
+		expError     bool
+	}{
+		{"kube-system/thing-config:config.json", "kube-system", "thing-config", "config.json", false},
+		{"kube-system/thing-config", "", "", "", true},
+		{"kube-system/thing-config:", "", "", "", true},
+		{"thing-config:config.json", "", "", "", true},
+		{"/thing-config:config.json", "", "", "", true},
+	}
+
+	for _, tc := range testCases {
+		namespace, name, key, err := ParseConfigMap(tc.configMap)
+		if err != nil && !tc.expError {
+			t.Errorf("%q: expected no error, got %v", tc.configMap, err)
+		} else if err == nil && tc.expError {
+			t.Errorf("%q: expected error, got none", tc.configMap)
+		}
+		if namespace != tc.expNamespace || name != tc.expName || key != tc.expKey {
+			t.Errorf("%q: expected (%q, %q, %q), got (%q, %q, %q)", tc.configMap,
+				tc.expNamespace, tc.expName, tc.expKey, namespace, name, key)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	goflag "flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+
+	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/cmd/cpvpa/options"
+	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/autoscaler"
+	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+)
+
+// runPlan prints how the autoscaler would change each target right now,
+// without changing anything.
+func runPlan(args []string) int {
+	config := options.NewAutoScalerConfig()
+	fs := newFlagSet("plan", "[--kubeconfig=<file>] <the same flags as the autoscaler>")
+	config.AddFlags(fs)
+	fs.SetNormalizeFunc(options.WordSepNormalizeFunc)
+	fs.AddGoFlagSet(goflag.CommandLine)
+	// Flag errors are logged, so they must be seen.
+	_ = goflag.Set("logtostderr", "true")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if config.Controller {
+		fmt.Fprintf(os.Stderr, "--controller is not supported: the status of each ProportionalVerticalScaler shows its desired resources\n")
+		return 2
+	}
+	if err := config.ValidateFlags(); err != nil {
+		return 2
+	}
+	config.DryRun = true
+
+	scaler, err := autoscaler.NewAutoScaler(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	clusterSize, plans, err := scaler.Plan()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	writePlan(os.Stdout, clusterSize, plans)
+	return 0
+}
+
+// writePlan writes, for each target, the change to each resource in the
+// config of each container, and each resource which would be removed.
+func writePlan(w io.Writer, clusterSize *k8sclient.ClusterSize, plans []autoscaler.TargetPlan) {
+	fmt.Fprintf(w, "Cluster size: %d nodes, %d cores\n", clusterSize.Nodes, clusterSize.Cores)
+	changed := 0
+	for _, plan := range plans {
+		fmt.Fprintf(w, "\n%s:\n", plan.Target)
+		if plan.Err != nil {
+			fmt.Fprintf(w, "  error: %v\n", plan.Err)
+			continue
+		}
+		for _, clamped := range plan.Clamped {
+			fmt.Fprintf(w, "  clamped to the namespace policy: %s\n", clamped)
+		}
+		targetChanged := false
+		ctrs := sortedKeys(plan.Desired)
+		for _, ctr := range sortedKeys(plan.Removed) {
+			if _, found := plan.Desired[ctr]; !found {
+				ctrs = append(ctrs, ctr)
+			}
+		}
+		sort.Strings(ctrs)
+		for _, ctr := range ctrs {
+			current, found := plan.Current[ctr]
+			if !found {
+				fmt.Fprintf(w, "  %s: not found in the target\n", ctr)
+				continue
+			}
+			if isPending(plan, ctr) {
+				if plan.PendingUntil.IsZero() {
+					fmt.Fprintf(w, "  %s: pending, its maintenance window never opens\n", ctr)
+				} else {
+					fmt.Fprintf(w, "  %s: pending until %s\n", ctr, plan.PendingUntil.Format(time.RFC3339))
+				}
+				continue
+			}
+			fmt.Fprintf(w, "  %s:\n", ctr)
+			desired, removed := plan.Desired[ctr], plan.Removed[ctr]
+			if writeResourceChanges(w, "requests", current.Requests, desired.Requests, removed.Requests) {
+				targetChanged = true
+			}
+			if writeResourceChanges(w, "limits", current.Limits, desired.Limits, removed.Limits) {
+				targetChanged = true
+			}
+		}
+		if targetChanged {
+			changed++
+		}
+	}
+	fmt.Fprintf(w, "\n%d of %d targets would be changed.\n", changed, len(plans))
+}
+
+func writeResourceChanges(w io.Writer, field string, current, desired, removed apiv1.ResourceList) bool {
+	changed := false
+	for _, res := range sortedKeys(toStringKeys(desired)) {
+		want := desired[apiv1.ResourceName(res)]
+		have, found := current[apiv1.ResourceName(res)]
+		switch {
+		case !found:
+			fmt.Fprintf(w, "    %s.%s: <none> -> %s\n", field, res, &want)
+			changed = true
+		case have.Cmp(want) != 0:
+			fmt.Fprintf(w, "    %s.%s: %s -> %s\n", field, res, &have, &want)
+			changed = true
+		default:
+			fmt.Fprintf(w, "    %s.%s: %s (unchanged)\n", field, res, &have)
+		}
+	}
+	for _, res := range sortedKeys(toStringKeys(removed)) {
+		have := removed[apiv1.ResourceName(res)]
+		fmt.Fprintf(w, "    %s.%s: %s -> <removed>\n", field, res, &have)
+		changed = true
+	}
+	return changed
+}
+
+func isPending(plan autoscaler.TargetPlan, ctr string) bool {
+	for _, pending := range plan.Pending {
+		if pending == ctr {
+			return true
+		}
+	}
+	return false
+}
+
+func toStringKeys(resources apiv1.ResourceList) map[string]bool {
+	keys := map[string]bool{}
+	for res := range resources {
+		keys[string(res)] = true
+	}
+	return keys
+}
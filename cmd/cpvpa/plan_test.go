@@ -0,0 +1,118 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/autoscaler"
+	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+)
+
+func TestWritePlan(t *testing.T) {
+	plans := []autoscaler.TargetPlan{
+		{
+			Target: k8sclient.Target{Kind: "Deployment", Namespace: "kube-system", Name: "coredns"},
+			Current: map[string]apiv1.ResourceRequirements{
+				"coredns": {
+					Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("100m"), apiv1.ResourceMemory: resource.MustParse("70Mi")},
+					Limits:   apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("1")},
+				},
+				"autopath": {
+					Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("10m")},
+				},
+			},
+			Desired: map[string]apiv1.ResourceRequirements{
+				"coredns": {
+					Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("0.026"), apiv1.ResourceMemory: resource.MustParse("73400320")},
+					Limits:   apiv1.ResourceList{apiv1.ResourceMemory: resource.MustParse("170Mi")},
+				},
+				"missing": {},
+			},
+			Removed: map[string]apiv1.ResourceRequirements{
+				"coredns": {
+					Limits: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("1")},
+				},
+				"autopath": {
+					Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("10m")},
+				},
+			},
+		},
+		{
+			Target: k8sclient.Target{Kind: "Deployment", Namespace: "kube-system", Name: "metrics-server"},
+			Err:    fmt.Errorf("not found"),
+		},
+		{
+			Target: k8sclient.Target{Kind: "Deployment", Namespace: "kube-system", Name: "thing"},
+			Current: map[string]apiv1.ResourceRequirements{
+				"thing": {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("1")}},
+			},
+			Desired: map[string]apiv1.ResourceRequirements{
+				"thing": {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("2")}},
+			},
+			Clamped: []string{`thing requests["cpu"] 3 is above the max 2 of LimitRange limits`},
+		},
+		{
+			Target: k8sclient.Target{Kind: "Deployment", Namespace: "kube-system", Name: "windowed"},
+			Current: map[string]apiv1.ResourceRequirements{
+				"windowed": {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("1")}},
+			},
+			Desired: map[string]apiv1.ResourceRequirements{
+				"windowed": {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("1")}},
+			},
+			Pending:      []string{"windowed"},
+			PendingUntil: time.Date(2024, 3, 6, 2, 0, 0, 0, time.UTC),
+		},
+	}
+
+	var buf bytes.Buffer
+	writePlan(&buf, &k8sclient.ClusterSize{Nodes: 4, Cores: 16}, plans)
+	expected := `Cluster size: 4 nodes, 16 cores
+
+deployment/kube-system/coredns:
+  autopath:
+    requests.cpu: 10m -> <removed>
+  coredns:
+    requests.cpu: 100m -> 26m
+    requests.memory: 70Mi (unchanged)
+    limits.memory: <none> -> 170Mi
+    limits.cpu: 1 -> <removed>
+  missing: not found in the target
+
+deployment/kube-system/metrics-server:
+  error: not found
+
+deployment/kube-system/thing:
+  clamped to the namespace policy: thing requests["cpu"] 3 is above the max 2 of LimitRange limits
+  thing:
+    requests.cpu: 1 -> 2
+
+deployment/kube-system/windowed:
+  windowed: pending until 2024-03-06T02:00:00Z
+
+2 of 4 targets would be changed.
+`
+	if buf.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, buf.String())
+	}
+}
@@ -0,0 +1,245 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	apiv1 "k8s.io/api/core/v1"
+
+	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/autoscaler"
+	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+)
+
+// simulation is the resources computed for one cluster size.
+type simulation struct {
+	Nodes     int                                   `json:"nodes"`
+	Cores     int                                   `json:"cores"`
+	Resources map[string]apiv1.ResourceRequirements `json:"resources"`
+}
+
+// runSimulate prints the resources a config gives over a set of cluster sizes.
+func runSimulate(args []string) int {
+	fs := newFlagSet("simulate", "[--default-config=<config>] [--config-file=<path>...] [--config-overlay=<file>] (--size=<nodes>:<cores>... | --nodes=<from>-<to>[/<step>] --cores-per-node=<cores>)")
+	defaultConfig := fs.String("default-config", "", "The default configuration (in JSON or YAML format).")
+	configPaths := fs.StringSlice("config-file", nil, "Config files (in JSON or YAML format), or directories of them, which are merged in order over the --default-config.")
+	configOverlay := fs.String("config-overlay", "", "A config file (in JSON or YAML format) for this cluster, which is merged over the --config-file.")
+	sizes := fs.StringSlice("size", nil, "Cluster sizes to simulate, each in the format <nodes>:<cores>.")
+	nodes := fs.String("nodes", "", "A range of node counts to simulate, in the format <from>-<to>[/<step>].")
+	coresPerNode := fs.Int("cores-per-node", 0, "The number of cores of each node in the --nodes range.")
+	output := fs.String("output", "table", "The output format: table, csv or json.")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if *defaultConfig == "" && len(*configPaths) == 0 {
+		fmt.Fprintf(os.Stderr, "Either --default-config or --config-file must be specified\n")
+		return 2
+	}
+
+	clusterSizes, err := parseClusterSizes(*sizes, *nodes, *coresPerNode)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+	paths := *configPaths
+	if *configOverlay != "" {
+		paths = append(paths, *configOverlay)
+	}
+	configFiles, err := autoscaler.ExpandConfigPaths(paths)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	cfg, err := autoscaler.LoadConfig(*defaultConfig, configFiles...)
+	if err != nil {
+		printError(os.Stderr, "Invalid config", err)
+		return 1
+	}
+
+	sims := []simulation{}
+	for i := range clusterSizes {
+		resources, err := autoscaler.ComputeRequirements(cfg, &clusterSizes[i])
+		if err != nil {
+			printError(os.Stderr, fmt.Sprintf("Failed to compute resources for %d nodes and %d cores", clusterSizes[i].Nodes, clusterSizes[i].Cores), err)
+			return 1
+		}
+		sims = append(sims, simulation{
+			Nodes:     clusterSizes[i].Nodes,
+			Cores:     clusterSizes[i].Cores,
+			Resources: resources,
+		})
+	}
+	if err := writeSimulations(os.Stdout, *output, sims); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// parseClusterSizes returns the listed cluster sizes and those in the range of
+// node counts, from smallest to largest.
+func parseClusterSizes(sizes []string, nodes string, coresPerNode int) ([]k8sclient.ClusterSize, error) {
+	clusterSizes := []k8sclient.ClusterSize{}
+	for _, size := range sizes {
+		n, c, found := strings.Cut(size, ":")
+		if !found {
+			return nil, fmt.Errorf("invalid --size %q: must be <nodes>:<cores>", size)
+		}
+		numNodes, err := parseCount(n)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --size %q: %v", size, err)
+		}
+		numCores, err := parseCount(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --size %q: %v", size, err)
+		}
+		clusterSizes = append(clusterSizes, k8sclient.ClusterSize{Nodes: numNodes, Cores: numCores})
+	}
+
+	if nodes != "" {
+		if coresPerNode < 1 {
+			return nil, fmt.Errorf("--cores-per-node must be at least 1 with --nodes")
+		}
+		r, s, hasStep := strings.Cut(nodes, "/")
+		from, to, found := strings.Cut(r, "-")
+		if !found {
+			return nil, fmt.Errorf("invalid --nodes %q: must be <from>-<to>[/<step>]", nodes)
+		}
+		start, err := parseCount(from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --nodes %q: %v", nodes, err)
+		}
+		end, err := parseCount(to)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --nodes %q: %v", nodes, err)
+		}
+		step := 1
+		if hasStep {
+			if step, err = parseCount(s); err != nil || step == 0 {
+				return nil, fmt.Errorf("invalid --nodes %q: step must be a positive number", nodes)
+			}
+		}
+		if end < start {
+			return nil, fmt.Errorf("invalid --nodes %q: %d is less than %d", nodes, end, start)
+		}
+		for n := start; n <= end; n += step {
+			clusterSizes = append(clusterSizes, k8sclient.ClusterSize{Nodes: n, Cores: n * coresPerNode})
+		}
+	}
+
+	if len(clusterSizes) == 0 {
+		return nil, fmt.Errorf("either --size or --nodes must be specified")
+	}
+	sort.SliceStable(clusterSizes, func(i, j int) bool {
+		if clusterSizes[i].Nodes != clusterSizes[j].Nodes {
+			return clusterSizes[i].Nodes < clusterSizes[j].Nodes
+		}
+		return clusterSizes[i].Cores < clusterSizes[j].Cores
+	})
+	return clusterSizes, nil
+}
+
+func parseCount(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a non-negative number", s)
+	}
+	return n, nil
+}
+
+// writeSimulations writes one row for each resource of each container at each
+// cluster size, with its request and limit.
+func writeSimulations(w io.Writer, format string, sims []simulation) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(sims)
+	}
+
+	header := []string{"NODES", "CORES", "CONTAINER", "RESOURCE", "REQUEST", "LIMIT"}
+	rows := [][]string{}
+	for _, sim := range sims {
+		for _, ctr := range sortedKeys(sim.Resources) {
+			reqs := sim.Resources[ctr]
+			names := map[string]bool{}
+			for res := range reqs.Requests {
+				names[string(res)] = true
+			}
+			for res := range reqs.Limits {
+				names[string(res)] = true
+			}
+			for _, res := range sortedKeys(names) {
+				rows = append(rows, []string{
+					strconv.Itoa(sim.Nodes),
+					strconv.Itoa(sim.Cores),
+					ctr,
+					res,
+					quantityString(reqs.Requests, res),
+					quantityString(reqs.Limits, res),
+				})
+			}
+		}
+	}
+
+	switch format {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(header, "\t"))
+		for _, row := range rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	case "csv":
+		cw := csv.NewWriter(w)
+		for i := range header {
+			header[i] = strings.ToLower(header[i])
+		}
+		if err := cw.Write(header); err != nil {
+			return err
+		}
+		if err := cw.WriteAll(rows); err != nil {
+			return err
+		}
+		return cw.Error()
+	}
+	return fmt.Errorf("unknown --output %q: must be table, csv or json", format)
+}
+
+func quantityString(resources apiv1.ResourceList, res string) string {
+	q, found := resources[apiv1.ResourceName(res)]
+	if !found {
+		return "-"
+	}
+	return q.String()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/autoscaler"
+	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+)
+
+func TestParseClusterSizes(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		sizes        []string
+		nodes        string
+		coresPerNode int
+		expSizes     []k8sclient.ClusterSize
+		expErr       bool
+	}{
+		{
+			"list",
+			[]string{"10:40", "1:2"},
+			"",
+			0,
+			[]k8sclient.ClusterSize{{Nodes: 1, Cores: 2}, {Nodes: 10, Cores: 40}},
+			false,
+		},
+		{
+			"range with step",
+			nil,
+			"0-10/5",
+			4,
+			[]k8sclient.ClusterSize{{Nodes: 0, Cores: 0}, {Nodes: 5, Cores: 20}, {Nodes: 10, Cores: 40}},
+			false,
+		},
+		{
+			"list and range",
+			[]string{"2:16"},
+			"1-3",
+			2,
+			[]k8sclient.ClusterSize{{Nodes: 1, Cores: 2}, {Nodes: 2, Cores: 4}, {Nodes: 2, Cores: 16}, {Nodes: 3, Cores: 6}},
+			false,
+		},
+		{"nothing", nil, "", 0, nil, true},
+		{"bad size", []string{"10"}, "", 0, nil, true},
+		{"negative size", []string{"-1:4"}, "", 0, nil, true},
+		{"range without cores", nil, "1-3", 0, nil, true},
+		{"backwards range", nil, "3-1", 1, nil, true},
+		{"zero step", nil, "1-3/0", 1, nil, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sizes, err := parseClusterSizes(tt.sizes, tt.nodes, tt.coresPerNode)
+			if tt.expErr {
+				if err == nil {
+					t.Errorf("expected an error, got %v", sizes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(sizes, tt.expSizes) {
+				t.Errorf("expected %v, got %v", tt.expSizes, sizes)
+			}
+		})
+	}
+}
+
+func TestWriteSimulations(t *testing.T) {
+	cfg, err := autoscaler.LoadConfig(`{"coredns":{"requests":{"cpu":{"base":"10m","step":"1m","coresPerStep":1}},"limits":{"memory":{"base":"1Gi"}}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := &k8sclient.ClusterSize{Nodes: 2, Cores: 8}
+	resources, err := autoscaler.ComputeRequirements(cfg, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sims := []simulation{{Nodes: 2, Cores: 8, Resources: resources}}
+
+	for _, tt := range []struct {
+		format string
+		exp    string
+	}{
+		{
+			"table",
+			"NODES  CORES  CONTAINER  RESOURCE  REQUEST  LIMIT\n" +
+				"2      8      coredns    cpu       18m      -\n" +
+				"2      8      coredns    memory    -        1Gi\n",
+		},
+		{
+			"csv",
+			"nodes,cores,container,resource,request,limit\n" +
+				"2,8,coredns,cpu,18m,-\n" +
+				"2,8,coredns,memory,-,1Gi\n",
+		},
+	} {
+		var buf bytes.Buffer
+		if err := writeSimulations(&buf, tt.format, sims); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.format, err)
+		}
+		if buf.String() != tt.exp {
+			t.Errorf("%s: expected\n%s\ngot\n%s", tt.format, tt.exp, buf.String())
+		}
+	}
+	if err := writeSimulations(&bytes.Buffer{}, "yaml", sims); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+}
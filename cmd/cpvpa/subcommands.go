@@ -0,0 +1,73 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/pflag"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// subcommands run instead of the autoscaler when named by the first argument.
+// Each returns the exit code.
+var subcommands = map[string]func(args []string) int{
+	"validate": runValidate,
+	"simulate": runSimulate,
+	"plan":     runPlan,
+}
+
+// newFlagSet returns a FlagSet for a subcommand, whose usage shows how to
+// call it.
+func newFlagSet(name, usage string) *pflag.FlagSet {
+	fs := pflag.NewFlagSet(name, pflag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: cpvpa %s %s\n\nFlags:\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses the arguments of a subcommand.  If they are invalid, or
+// help was asked for, it returns false along with the exit code.
+func parseFlags(fs *pflag.FlagSet, args []string) (int, bool) {
+	err := fs.Parse(args)
+	if err == pflag.ErrHelp {
+		return 0, false
+	}
+	if err != nil {
+		return 2, false
+	}
+	return 0, true
+}
+
+// printError writes an error, putting each of a list of errors on its own
+// line.
+func printError(w io.Writer, prefix string, err error) {
+	var agg utilerrors.Aggregate
+	if !errors.As(err, &agg) {
+		fmt.Fprintf(w, "%s: %v\n", prefix, err)
+		return
+	}
+	fmt.Fprintf(w, "%s:\n", prefix)
+	for _, e := range agg.Errors() {
+		fmt.Fprintf(w, "  %v\n", e)
+	}
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/autoscaler"
+)
+
+// runValidate checks config files, and those in directories, each layered
+// between an optional default config and overlay, without connecting to a
+// cluster.
+func runValidate(args []string) int {
+	fs := newFlagSet("validate", "[--default-config=<config>] [--config-overlay=<file>] <config-file-or-directory>...")
+	defaultConfig := fs.String("default-config", "", "The default configuration (in JSON or YAML format), which each config file is merged over.")
+	configOverlay := fs.String("config-overlay", "", "A config file (in JSON or YAML format) for one cluster, which is merged over each config file.")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() == 0 && *defaultConfig == "" {
+		fs.Usage()
+		return 2
+	}
+
+	if _, err := autoscaler.LoadConfig(*defaultConfig); err != nil {
+		printError(os.Stderr, "--default-config", err)
+		return 1
+	}
+	paths, err := autoscaler.ExpandConfigPaths(fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	code := 0
+	for _, path := range paths {
+		configFiles := []string{path}
+		if *configOverlay != "" {
+			configFiles = append(configFiles, *configOverlay)
+		}
+		if _, err := autoscaler.LoadConfig(*defaultConfig, configFiles...); err != nil {
+			printError(os.Stderr, path, err)
+			code = 1
+			continue
+		}
+		fmt.Printf("%s: OK\n", path)
+	}
+	return code
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/autoscaler"
+)
+
+// SchemeGroupVersion is the group and version of this API.
+var SchemeGroupVersion = schema.GroupVersion{Group: "cpvpa.x-k8s.io", Version: "v1alpha1"}
+
+// Resource is the resource of ProportionalVerticalScaler objects.
+var Resource = SchemeGroupVersion.WithResource("proportionalverticalscalers")
+
+// ProportionalVerticalScaler scales the resources of the containers of a
+// workload in proportion to the size of the cluster.
+type ProportionalVerticalScaler struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ProportionalVerticalScalerSpec   `json:"spec"`
+	Status ProportionalVerticalScalerStatus `json:"status,omitempty"`
+}
+
+// ProportionalVerticalScalerSpec is the desired behaviour of a
+// ProportionalVerticalScaler.
+type ProportionalVerticalScalerSpec struct {
+	// TargetRef points to the Deployment, DaemonSet or ReplicaSet to scale,
+	// in the same namespace.  Its APIVersion is optional, and if set must be
+	// a version which serves the kind, such as apps/v1.
+	TargetRef autoscalingv1.CrossVersionObjectReference `json:"targetRef"`
+	// Containers maps container names to their scaling config, in the same
+	// format as --default-config.
+	Containers autoscaler.ScaleConfig `json:"containers"`
+	// Behavior controls how computed resources are applied to the target.
+	Behavior *ScalingBehavior `json:"behavior,omitempty"`
+}
+
+// UpdateMode controls whether computed resources are applied to the target.
+type UpdateMode string
+
+const (
+	// UpdateModeAuto applies computed resources to the target.
+	UpdateModeAuto UpdateMode = "Auto"
+	// UpdateModeOff only reports computed resources in the status, as
+	// desiredResources.
+	UpdateModeOff UpdateMode = "Off"
+)
+
+// ScalingBehavior holds the knobs which control how changes are applied.
+type ScalingBehavior struct {
+	// UpdateMode defaults to Auto.
+	UpdateMode UpdateMode `json:"updateMode,omitempty"`
+}
+
+// ProportionalVerticalScalerStatus is the most recently observed state of a
+// ProportionalVerticalScaler.
+type ProportionalVerticalScalerStatus struct {
+	// ObservedGeneration is the generation of the spec which was last
+	// reconciled.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// ClusterSize is the cluster size which was last observed.
+	ClusterSize *ClusterSize `json:"clusterSize,omitempty"`
+	// DesiredResources are the resources computed for each container of the
+	// target at the observed cluster size.
+	DesiredResources map[string]apiv1.ResourceRequirements `json:"desiredResources,omitempty"`
+	// LastAppliedResources are the resources which were last applied to each
+	// container of the target.
+	LastAppliedResources map[string]apiv1.ResourceRequirements `json:"lastAppliedResources,omitempty"`
+	// LastUpdateTime is when resources were last applied to the target.
+	LastUpdateTime *metav1.Time `json:"lastUpdateTime,omitempty"`
+	// Conditions describe the current state of the scaler.
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// ClusterSize is the number of nodes and cores in the cluster.
+type ClusterSize struct {
+	Nodes int `json:"nodes"`
+	Cores int `json:"cores"`
+}
+
+// ConditionReady is true when the target has the resources computed for the
+// current cluster size.
+const ConditionReady = "Ready"
+
+// Reasons for the Ready condition.
+const (
+	ReasonResourcesApplied        = "ResourcesApplied"
+	ReasonUpdateDisabled          = "UpdateDisabled"
+	ReasonInvalidTarget           = "InvalidTarget"
+	ReasonInvalidConfig           = "InvalidConfig"
+	ReasonCalculationFailed       = "CalculationFailed"
+	ReasonUpdateFailed            = "UpdateFailed"
+	ReasonResourcesClamped        = "ResourcesClamped"
+	ReasonNamespacePolicyConflict = "NamespacePolicyConflict"
+	ReasonUpdatePending           = "UpdatePending"
+)
@@ -20,13 +20,20 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"math"
 	"os"
 	"reflect"
+	"strings"
+	"sync"
 	"time"
 
 	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/utils/clock"
 
 	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/cmd/cpvpa/options"
@@ -39,36 +46,114 @@ import (
 type AutoScaler struct {
 	k8sClient     k8sclient.K8sClient
 	defaultConfig ScaleConfig
-	configFile    string
-	lastFileInfo  os.FileInfo
+	configPaths   []string
+	configMap     *k8sclient.ConfigMapWatcher
+	configOverlay string
+	configFiles   []*fileLayer
+	fileWatcher   *fileWatcher
 	currentConfig ScaleConfig
-	lastReqs      map[string]apiv1.ResourceRequirements
+	lastReqs      map[k8sclient.Target]map[string]apiv1.ResourceRequirements
 	pollPeriod    time.Duration
 	clock         clock.WithTicker
 	stopCh        chan struct{}
 	readyCh       chan<- struct{} // For testing.
+
+	// The last value read from the configMap, and whether it was found.
+	lastConfigMapData  string
+	lastConfigMapFound bool
+
+	// configErr is why the config last failed to load, while the last good
+	// config is used.  It is read by Ready, so it is guarded by configLock.
+	configLock   sync.Mutex
+	configErr    error
+	configLoaded bool
+
+	// The error from the last poll which failed to compute resources.
+	lastCalculationErr string
+
+	// Set when each target carries its own config in an annotation.
+	annotatedTargets bool
+	invalidConfigs   map[k8sclient.Target]string
+
+	// How resources which conflict with the namespace of a target are
+	// handled, and the last conflict reported on each target.
+	namespacePolicy string
+	policyConflicts map[k8sclient.Target]string
+
+	// The last pending update reported on each target, which is held until
+	// a maintenance window opens.
+	pendingUpdates map[k8sclient.Target]string
+
+	// Set to revert updates which don't roll out within the deadline.  The
+	// updates which are rolling out, and those which were reverted.
+	rolloutDeadline time.Duration
+	rollouts        map[k8sclient.Target]*rollout
+	failedRollouts  map[k8sclient.Target]map[string]apiv1.ResourceRequirements
+
+	// The minimum time between updates of a target, and when each target was
+	// last updated.
+	updateCooldown time.Duration
+	lastUpdated    map[k8sclient.Target]time.Time
 }
 
 // NewAutoScaler returns a new AutoScaler
 func NewAutoScaler(c *options.AutoScalerConfig) (*AutoScaler, error) {
-	newK8sClient, err := k8sclient.NewK8sClient(c.Namespace, c.Target, c.Kubeconfig, c.DryRun)
+	newK8sClient, err := k8sclient.NewK8sClient(c.K8sClientOptions())
 	if err != nil {
 		return nil, err
 	}
 	cfg := ScaleConfig{}
 	if c.DefaultConfig != "" {
-		if err := json.Unmarshal([]byte(c.DefaultConfig), &cfg); err != nil {
+		if err := ParseScaleConfig([]byte(c.DefaultConfig), &cfg); err != nil {
 			return nil, fmt.Errorf("invalid default config: %v", err)
 		}
 	}
+	var configMap *k8sclient.ConfigMapWatcher
+	if c.ConfigMap != "" {
+		namespace, name, key, err := options.ParseConfigMap(c.ConfigMap)
+		if err != nil {
+			return nil, err
+		}
+		config, err := k8sclient.BuildConfig(c.Kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+		clientset, err := kubernetes.NewForConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		configMap, err = k8sclient.NewConfigMapWatcher(clientset, namespace, name, key, wait.NeverStop)
+		if err != nil {
+			return nil, err
+		}
+	}
+	stopCh := make(chan struct{})
+	configPaths := c.ConfigFiles
+	if c.ConfigOverlay != "" {
+		configPaths = append(append([]string{}, configPaths...), c.ConfigOverlay)
+	}
+	var watcher *fileWatcher
+	if len(configPaths) > 0 {
+		// Polling still picks up changes, just more slowly.
+		if watcher, err = newFileWatcher(configPaths, stopCh); err != nil {
+			glog.Warningf("Failed to watch config files, changes will be picked up on the next poll: %v", err)
+		}
+	}
 	return &AutoScaler{
-		k8sClient:     newK8sClient,
-		defaultConfig: cfg,
-		configFile:    c.ConfigFile,
-		pollPeriod:    time.Second * time.Duration(c.PollPeriodSeconds),
-		clock:         clock.RealClock{},
-		stopCh:        make(chan struct{}),
-		readyCh:       make(chan struct{}, 1),
+		k8sClient:        newK8sClient,
+		defaultConfig:    cfg,
+		configPaths:      c.ConfigFiles,
+		configMap:        configMap,
+		configOverlay:    c.ConfigOverlay,
+		fileWatcher:      watcher,
+		annotatedTargets: c.AnnotatedTargets,
+		namespacePolicy:  c.NamespacePolicy,
+		rolloutDeadline:  c.RolloutDeadline,
+		updateCooldown:   c.UpdateCooldown,
+		pollPeriod:       time.Second * time.Duration(c.PollPeriodSeconds),
+		clock:            clock.RealClock{},
+		stopCh:           stopCh,
+		readyCh:          make(chan struct{}, 1),
 	}, nil
 }
 
@@ -86,13 +171,40 @@ func (s *AutoScaler) Run() {
 		select {
 		case <-ticker.C():
 			s.pollAPIServer()
+		case <-s.configMapChanged():
+			// Apply the new config without waiting for the ticker.
+			s.pollAPIServer()
+		case <-s.configFilesChanged():
+			s.pollAPIServer()
 		case <-s.stopCh:
 			return
 		}
 	}
 }
 
+// configMapChanged receives when the watched ConfigMap changes.  Without a
+// ConfigMap it never receives.
+func (s *AutoScaler) configMapChanged() <-chan struct{} {
+	if s.configMap == nil {
+		return nil
+	}
+	return s.configMap.Changed()
+}
+
+// configFilesChanged receives when a config file may have changed.  Without
+// config files it never receives.
+func (s *AutoScaler) configFilesChanged() <-chan struct{} {
+	if s.fileWatcher == nil {
+		return nil
+	}
+	return s.fileWatcher.Changed()
+}
+
 func (s *AutoScaler) pollAPIServer() {
+	if s.rolloutDeadline > 0 {
+		s.checkRollouts()
+	}
+
 	// Query the apiserver for the cluster status --- number of nodes and cores
 	clusterSize, err := s.k8sClient.GetClusterSize()
 	if err != nil {
@@ -102,57 +214,501 @@ func (s *AutoScaler) pollAPIServer() {
 	glog.V(4).Infof("Nodes %5d", clusterSize.Nodes)
 	glog.V(4).Infof("Cores %5d", clusterSize.Cores)
 
-	fileBytes, err := s.readConfigFileIfChanged()
+	if s.annotatedTargets {
+		s.scaleAnnotatedTargets(clusterSize)
+		return
+	}
+
+	targets, err := s.k8sClient.GetTargets()
 	if err != nil {
-		glog.Errorf("Failed to read config file %q: %v", s.configFile, err)
+		glog.Errorf("Error getting targets: %v", err)
 		return
 	}
-	if s.currentConfig == nil || len(fileBytes) > 0 {
-		cfg := s.defaultConfig.DeepCopy()
-		if len(fileBytes) > 0 {
-			if err := json.Unmarshal(fileBytes, &cfg); err != nil {
-				glog.Errorf("Failed to unmarshal config file %q: %v", s.configFile, err)
-				return
+
+	err = s.refreshConfig()
+	s.reportConfigError(err, targets)
+	if err != nil {
+		if s.currentConfig == nil {
+			glog.Errorf("Error loading config: %v", err)
+			return
+		}
+		glog.Errorf("Error reloading config, keeping the last good config: %v", err)
+	}
+
+	newReqs, err := ComputeRequirements(s.currentConfig, clusterSize)
+	if err != nil {
+		glog.Errorf("Error computing resources, not updating any target: %v", err)
+		// Only report each error once, rather than on every poll.
+		if err.Error() != s.lastCalculationErr {
+			for _, tgt := range targets {
+				s.k8sClient.RecordEvent(tgt, apiv1.EventTypeWarning, "CalculationFailed",
+					fmt.Sprintf("Failed to compute resources for %d nodes and %d cores: %v", clusterSize.Nodes, clusterSize.Cores, err))
 			}
 		}
-		s.currentConfig = cfg
-		glog.V(0).Infof("setting config = %s", s.currentConfig)
+		s.lastCalculationErr = err.Error()
+		return
+	}
+	s.lastCalculationErr = ""
+
+	// Targets which are no longer found are forgotten, so they are updated
+	// again if they reappear.
+	lastReqs := map[k8sclient.Target]map[string]apiv1.ResourceRequirements{}
+	for _, tgt := range targets {
+		if reqs, ok := s.updateTarget(tgt, s.currentConfig, newReqs, clusterSize); ok {
+			lastReqs[tgt] = reqs
+		}
+	}
+	s.lastReqs = lastReqs
+}
+
+// refreshConfig rebuilds the current config if any of its layers changed.
+// The layers are the default config, then the ConfigMap or each config file
+// in turn, then the config overlay.
+func (s *AutoScaler) refreshConfig() error {
+	// A config which failed to load is retried until it is fixed.
+	changed := s.currentConfig == nil || s.lastConfigErr() != nil
+	if s.configMap != nil && s.readConfigMapIfChanged() {
+		changed = true
+	}
+
+	paths := s.configPaths
+	if s.configOverlay != "" {
+		paths = append(append([]string{}, paths...), s.configOverlay)
+	}
+	files, filesChanged, err := readConfigFiles(paths, s.configFiles)
+	if err != nil {
+		return err
+	}
+	changed = changed || filesChanged
+	s.configFiles = files
+	if !changed {
+		return nil
+	}
+
+	cfg := s.defaultConfig.DeepCopy()
+	sources := []string{"default config"}
+	for _, layer := range s.configLayers() {
+		if err := ParseScaleConfig(layer.data, &cfg); err != nil {
+			return fmt.Errorf("failed to parse %s: %v", layer.source, err)
+		}
+		sources = append(sources, layer.source)
 	}
+	s.currentConfig = cfg
+	configLastReloadSuccessTimestamp.SetToCurrentTime()
+	effective, _ := json.Marshal(cfg)
+	glog.V(0).Infof("Effective config from %s: %s", strings.Join(sources, ", "), effective)
+	return nil
+}
+
+// reportConfigError records the outcome of loading the config.  Each new error
+// is reported once as an Event on every target, rather than on every poll, and
+// so is the recovery once the config is fixed.
+func (s *AutoScaler) reportConfigError(err error, targets []k8sclient.Target) {
+	s.configLock.Lock()
+	defer s.configLock.Unlock()
 
+	if err == nil {
+		configLastReloadSuccessful.Set(1)
+		if s.configErr != nil {
+			glog.V(0).Infof("Config is valid again")
+			for _, tgt := range targets {
+				s.k8sClient.RecordEvent(tgt, apiv1.EventTypeNormal, "ConfigRecovered", "Config is valid again")
+			}
+		}
+		s.configErr, s.configLoaded = nil, true
+		return
+	}
+
+	configLastReloadSuccessful.Set(0)
+	if s.configErr == nil || s.configErr.Error() != err.Error() {
+		configReloadFailures.Inc()
+		message := fmt.Sprintf("Invalid config: %v", err)
+		if s.configLoaded {
+			message = fmt.Sprintf("Invalid config, keeping the last good config: %v", err)
+		}
+		for _, tgt := range targets {
+			s.k8sClient.RecordEvent(tgt, apiv1.EventTypeWarning, "InvalidConfig", message)
+		}
+	}
+	s.configErr = err
+}
+
+// lastConfigErr returns why the config last failed to load, if it did.
+func (s *AutoScaler) lastConfigErr() error {
+	s.configLock.Lock()
+	defer s.configLock.Unlock()
+	return s.configErr
+}
+
+// Ready returns why the autoscaler is not ready: the config has not been
+// loaded yet, or the last change to it is invalid.
+func (s *AutoScaler) Ready() error {
+	if s.annotatedTargets {
+		return nil
+	}
+	s.configLock.Lock()
+	defer s.configLock.Unlock()
+	switch {
+	case s.configErr != nil && s.configLoaded:
+		return fmt.Errorf("invalid config, keeping the last good config: %v", s.configErr)
+	case s.configErr != nil:
+		return fmt.Errorf("invalid config: %v", s.configErr)
+	case !s.configLoaded:
+		return fmt.Errorf("config has not been loaded yet")
+	}
+	return nil
+}
+
+// configLayer is a config to merge over the default config.
+type configLayer struct {
+	source string
+	data   []byte
+}
+
+// configLayers returns the config layers which were last read, in the order
+// they are merged.
+func (s *AutoScaler) configLayers() []configLayer {
+	layers := []configLayer{}
+	if s.configMap != nil {
+		if s.lastConfigMapFound {
+			layers = append(layers, configLayer{fmt.Sprintf("ConfigMap %s", s.configMap), []byte(s.lastConfigMapData)})
+		} else {
+			glog.Warningf("ConfigMap %s not found, falling back to the default config", s.configMap)
+		}
+	}
+	for _, f := range s.configFiles {
+		layers = append(layers, configLayer{f.String(), f.data})
+	}
+	return layers
+}
+
+// scaleAnnotatedTargets scales every target which carries a config annotation,
+// each according to its own config.
+func (s *AutoScaler) scaleAnnotatedTargets(clusterSize *k8sclient.ClusterSize) {
+	configs, err := s.k8sClient.GetTargetConfigs()
+	if err != nil {
+		glog.Errorf("Error getting target configs: %v", err)
+		return
+	}
+
+	lastReqs := map[k8sclient.Target]map[string]apiv1.ResourceRequirements{}
+	invalidConfigs := map[k8sclient.Target]string{}
+	for tgt, raw := range configs {
+		cfg := ScaleConfig{}
+		if err := ParseScaleConfig([]byte(raw), &cfg); err != nil {
+			invalidConfigs[tgt] = raw
+			// Only report each bad value once, rather than on every poll.
+			if s.invalidConfigs[tgt] != raw {
+				glog.Errorf("Failed to parse %s annotation of %s: %v", k8sclient.ConfigAnnotation, tgt, err)
+				s.k8sClient.RecordEvent(tgt, apiv1.EventTypeWarning, "InvalidConfig",
+					fmt.Sprintf("Failed to parse %s annotation: %v", k8sclient.ConfigAnnotation, err))
+			}
+			continue
+		}
+
+		newReqs, err := ComputeRequirements(cfg, clusterSize)
+		if err != nil {
+			invalidConfigs[tgt] = raw
+			glog.Errorf("Error computing resources of %s: %v", tgt, err)
+			if s.invalidConfigs[tgt] != raw {
+				s.k8sClient.RecordEvent(tgt, apiv1.EventTypeWarning, "CalculationFailed",
+					fmt.Sprintf("Failed to compute resources for %d nodes and %d cores: %v", clusterSize.Nodes, clusterSize.Cores, err))
+			}
+			continue
+		}
+		if reqs, ok := s.updateTarget(tgt, cfg, newReqs, clusterSize); ok {
+			lastReqs[tgt] = reqs
+		}
+	}
+	s.lastReqs = lastReqs
+	s.invalidConfigs = invalidConfigs
+	invalidTargetConfigs.Set(float64(len(invalidConfigs)))
+}
+
+// ComputeRequirements calculates the resources of every container in the
+// config for the given cluster size.  It fails if any quantity is too large
+// to compute, rather than setting a wrong one.
+func ComputeRequirements(config ScaleConfig, clusterSize *k8sclient.ClusterSize) (map[string]apiv1.ResourceRequirements, error) {
 	newReqs := map[string]apiv1.ResourceRequirements{}
-	for ctr, ctrcfg := range s.currentConfig {
+	errs := []error{}
+	for ctr, ctrcfg := range config {
 		newReqs[ctr] = apiv1.ResourceRequirements{
 			Requests: map[apiv1.ResourceName]resource.Quantity{},
 			Limits:   map[apiv1.ResourceName]resource.Quantity{},
 		}
+		clusterSize := clusterSize
+		if ctrcfg.Topology != nil {
+			clusterSize = clusterSize.ForTopology(ctrcfg.Topology.Key, ctrcfg.Topology.Value)
+			// This is computed on every poll, so an empty domain is only
+			// logged verbosely rather than warned about each time.
+			if clusterSize.Nodes == 0 {
+				glog.V(2).Infof("No nodes found in topology %s of %s, scaling it as if there were none", ctrcfg.Topology, ctr)
+			}
+			glog.V(4).Infof("Topology %s of %s: nodes %d, cores %d", ctrcfg.Topology, ctr, clusterSize.Nodes, clusterSize.Cores)
+		}
 		for res, cfg := range ctrcfg.Requests {
-			want := calculate(cfg, clusterSize)
-			r := resource.NewQuantity(0, guessFormat(res))
+			want, err := calculate(cfg, clusterSize)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s.requests.%s: %v", ctr, res, err))
+				continue
+			}
+			r := resource.NewQuantity(0, cfg.format())
 			r.SetMilli(want)
 			newReqs[ctr].Requests[apiv1.ResourceName(res)] = *r
 			glog.V(4).Infof("Calculated %s requests[%q] = %v", ctr, res, r)
 		}
 		for res, cfg := range ctrcfg.Limits {
-			want := calculate(cfg, clusterSize)
-			r := resource.NewQuantity(0, guessFormat(res))
+			want, err := calculate(cfg, clusterSize)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s.limits.%s: %v", ctr, res, err))
+				continue
+			}
+			r := resource.NewQuantity(0, cfg.format())
 			r.SetMilli(want)
 			newReqs[ctr].Limits[apiv1.ResourceName(res)] = *r
 			glog.V(4).Infof("Calculated %s limits[%q] = %v", ctr, res, r)
 		}
+		for res, fraction := range ctrcfg.MaxAllocatableFraction {
+			req, found := newReqs[ctr].Requests[apiv1.ResourceName(res)]
+			if !found {
+				continue
+			}
+			max, found := clusterSize.MinAllocatable(apiv1.ResourceName(res))
+			if !found {
+				glog.V(4).Infof("No node has allocatable %s, not capping %s requests[%q]", res, ctr, res)
+				continue
+			}
+			// The fraction is at most 1, so the cap fits in an int64.  It is
+			// rounded down to whole units, and to the roundTo of the request,
+			// so that it is written like a computed request.
+			capped := int64(math.Floor(float64(max.MilliValue()) * fraction))
+			if !fractionalUnits(res) {
+				capped -= capped % 1000
+			}
+			if roundTo := ctrcfg.Requests[res].RoundTo; roundTo != nil && roundTo.MilliValue() > 0 {
+				capped -= capped % roundTo.MilliValue()
+			}
+			if req.MilliValue() <= capped {
+				continue
+			}
+			r := resource.NewQuantity(0, req.Format)
+			r.SetMilli(capped)
+			newReqs[ctr].Requests[apiv1.ResourceName(res)] = *r
+			glog.V(2).Infof("Capped %s requests[%q] = %v at %g of the smallest allocatable %v", ctr, res, r, fraction, &max)
+		}
+		// Limits derived from requests are computed from the rounded and
+		// capped request, so they can't drift apart.
+		for res, equal := range ctrcfg.LimitEqualsRequest {
+			req, found := newReqs[ctr].Requests[apiv1.ResourceName(res)]
+			if !equal || !found {
+				continue
+			}
+			newReqs[ctr].Limits[apiv1.ResourceName(res)] = req.DeepCopy()
+			glog.V(4).Infof("Calculated %s limits[%q] = %v", ctr, res, &req)
+		}
+		for res, ratio := range ctrcfg.LimitRatio {
+			req, found := newReqs[ctr].Requests[apiv1.ResourceName(res)]
+			if !found {
+				continue
+			}
+			// Floats above MaxInt64 can't be converted back.
+			want := math.Ceil(float64(req.MilliValue()) * ratio)
+			if want >= math.MaxInt64 {
+				errs = append(errs, fmt.Errorf("%s.limitRatio.%s: %v times %g overflows", ctr, res, &req, ratio))
+				continue
+			}
+			limit := int64(want)
+			if !fractionalUnits(res) {
+				// Limits are written in whole units, like computed ones.
+				var ok bool
+				if limit, ok = roundUp(limit, 1000, 0); !ok {
+					errs = append(errs, fmt.Errorf("%s.limitRatio.%s: %v times %g overflows", ctr, res, &req, ratio))
+					continue
+				}
+			}
+			r := resource.NewQuantity(0, req.Format)
+			r.SetMilli(limit)
+			newReqs[ctr].Limits[apiv1.ResourceName(res)] = *r
+			glog.V(4).Infof("Calculated %s limits[%q] = %v", ctr, res, r)
+		}
 	}
-	if reflect.DeepEqual(s.lastReqs, newReqs) {
-		return
+	if len(errs) > 0 {
+		calculationErrors.Inc()
+		return nil, utilerrors.NewAggregate(errs)
+	}
+	return newReqs, nil
+}
+
+// updateTarget sets new resources on a target, unless they were already set
+// by the previous poll.  It returns the resources which the target is set to,
+// and whether it is up to date.
+func (s *AutoScaler) updateTarget(tgt k8sclient.Target, cfg ScaleConfig, newReqs map[string]apiv1.ResourceRequirements, clusterSize *k8sclient.ClusterSize) (map[string]apiv1.ResourceRequirements, bool) {
+	// The namespace policy is read on every poll, so a change to it applies
+	// even if the cluster size does not change.
+	newReqs, clamped, ok := s.enforceNamespacePolicy(tgt, newReqs)
+	if !ok {
+		return nil, false
+	}
+	if newReqs, ok = s.holdOutsideMaintenanceWindows(tgt, cfg, newReqs); !ok {
+		return nil, false
+	}
+	if reflect.DeepEqual(s.lastReqs[tgt], newReqs) {
+		return newReqs, true
+	}
+	if s.coolingDown(tgt) {
+		// The latest resources are applied once the cooldown has passed.
+		reqs, found := s.lastReqs[tgt]
+		return reqs, found
+	}
+	var r *rollout
+	if s.rolloutDeadline > 0 {
+		if pending := s.rollouts[tgt]; pending != nil {
+			glog.V(2).Infof("Not updating %s until its last update rolls out", tgt)
+			return pending.applied, true
+		}
+		if reflect.DeepEqual(s.failedRollouts[tgt], newReqs) {
+			glog.V(2).Infof("Not updating %s with resources which failed to roll out", tgt)
+			return newReqs, true
+		}
+		var err error
+		if r, err = s.startRollout(tgt, newReqs); err != nil {
+			glog.Errorf("Failed to read the resources of %s, not updating it: %v", tgt, err)
+			return nil, false
+		}
 	}
 
-	glog.V(0).Infof("Updating resource for nodes: %d, cores: %d",
-		clusterSize.Nodes, clusterSize.Cores)
+	glog.V(0).Infof("Updating resource of %s for nodes: %d, cores: %d",
+		tgt, clusterSize.Nodes, clusterSize.Cores)
 	logRequirements(newReqs)
+	if len(clamped) > 0 {
+		glog.Warningf("Clamped the resources of %s to its namespace policy: %s", tgt, strings.Join(clamped, "; "))
+		s.k8sClient.RecordEvent(tgt, apiv1.EventTypeWarning, "ResourcesClamped",
+			fmt.Sprintf("Clamped resources to the namespace policy: %s", strings.Join(clamped, "; ")))
+	}
 	// Update resource target with new resources.
-	if err = s.k8sClient.UpdateResources(newReqs); err != nil {
-		glog.Errorf("Update failure: %s", err)
-	} else {
-		s.lastReqs = newReqs
+	if err := s.k8sClient.UpdateResources(tgt, newReqs); err != nil {
+		glog.Errorf("Update failure for %s: %s", tgt, err)
+		return nil, false
+	}
+	s.stampLastUpdated(tgt)
+	if r != nil {
+		r.started = s.clock.Now()
+		if s.rollouts == nil {
+			s.rollouts = map[k8sclient.Target]*rollout{}
+		}
+		s.rollouts[tgt] = r
+		delete(s.failedRollouts, tgt)
+	}
+	return newReqs, true
+}
+
+// coolingDown returns whether a target was updated less than the cooldown ago.
+// A target which was not updated since cpvpa started is checked for the time
+// recorded on it, so the cooldown outlives a restart.
+func (s *AutoScaler) coolingDown(tgt k8sclient.Target) bool {
+	if s.updateCooldown <= 0 {
+		return false
+	}
+	last, found := s.lastUpdated[tgt]
+	if !found {
+		var err error
+		if last, err = s.k8sClient.GetLastUpdated(tgt); err != nil {
+			glog.Errorf("Failed to read when %s was last updated, not updating it: %v", tgt, err)
+			return true
+		}
+		if last.IsZero() {
+			return false
+		}
+	}
+	if remaining := s.updateCooldown - s.clock.Since(last); remaining > 0 {
+		glog.V(2).Infof("Not updating %s for another %v, since it was updated at %s", tgt, remaining, last.Format(time.RFC3339))
+		return true
+	}
+	delete(s.lastUpdated, tgt)
+	return false
+}
+
+// stampLastUpdated starts the cooldown of a target which was just updated.
+func (s *AutoScaler) stampLastUpdated(tgt k8sclient.Target) {
+	if s.updateCooldown <= 0 {
+		return
+	}
+	if s.lastUpdated == nil {
+		s.lastUpdated = map[k8sclient.Target]time.Time{}
+	}
+	s.lastUpdated[tgt] = s.clock.Now()
+}
+
+// namespacePolicyFor reads the namespace policy of a target, or returns nil
+// if namespace policies are ignored.
+func (s *AutoScaler) namespacePolicyFor(tgt k8sclient.Target) (*k8sclient.ResourcePolicy, error) {
+	if s.namespacePolicy == "" || s.namespacePolicy == options.NamespacePolicyIgnore {
+		return nil, nil
+	}
+	return s.k8sClient.GetResourcePolicy(tgt)
+}
+
+// enforceNamespacePolicy returns the resources of a target after checking
+// them against the LimitRanges and ResourceQuotas of its namespace, and those
+// which were clamped.  A conflict is reported once as an Event, rather than on
+// every poll.
+func (s *AutoScaler) enforceNamespacePolicy(tgt k8sclient.Target, newReqs map[string]apiv1.ResourceRequirements) (map[string]apiv1.ResourceRequirements, []string, bool) {
+	policy, err := s.namespacePolicyFor(tgt)
+	if err != nil {
+		glog.Errorf("Failed to read the namespace policy of %s, not updating it: %v", tgt, err)
+		return nil, nil, false
+	}
+	if policy == nil {
+		return newReqs, nil, true
+	}
+	reqs, clamped, err := EnforceNamespacePolicy(s.namespacePolicy, policy, newReqs)
+	if err != nil {
+		glog.Errorf("Not updating %s, which would conflict with its namespace policy: %v", tgt, err)
+		if s.policyConflicts[tgt] != err.Error() {
+			s.k8sClient.RecordEvent(tgt, apiv1.EventTypeWarning, "NamespacePolicyConflict",
+				fmt.Sprintf("Not updating resources, which would conflict with the namespace policy: %v", err))
+		}
+		if s.policyConflicts == nil {
+			s.policyConflicts = map[k8sclient.Target]string{}
+		}
+		s.policyConflicts[tgt] = err.Error()
+		return nil, nil, false
+	}
+	delete(s.policyConflicts, tgt)
+	return reqs, clamped, true
+}
+
+// holdOutsideMaintenanceWindows returns the resources of a target with those
+// of each container whose maintenance window is closed held at their current
+// values.  Each new pending update is reported once as an Event.
+func (s *AutoScaler) holdOutsideMaintenanceWindows(tgt k8sclient.Target, cfg ScaleConfig, newReqs map[string]apiv1.ResourceRequirements) (map[string]apiv1.ResourceRequirements, bool) {
+	if !cfg.hasMaintenanceWindows() {
+		return newReqs, true
+	}
+	reqs, pending, next, err := HoldOutsideMaintenanceWindows(cfg, s.clock.Now(), newReqs, func() (map[string]apiv1.ResourceRequirements, error) {
+		return s.k8sClient.GetResources(tgt)
+	})
+	if err != nil {
+		glog.Errorf("Not updating %s: %v", tgt, err)
+		return nil, false
+	}
+	if len(pending) == 0 {
+		delete(s.pendingUpdates, tgt)
+		return reqs, true
 	}
+	message := fmt.Sprintf("Holding the new resources of %s until the maintenance window opens", strings.Join(pending, ", "))
+	if !next.IsZero() {
+		message = fmt.Sprintf("%s at %s", message, next.Format(time.RFC3339))
+	}
+	if s.pendingUpdates[tgt] != message {
+		glog.V(0).Infof("%s: %s", tgt, message)
+		s.k8sClient.RecordEvent(tgt, apiv1.EventTypeNormal, "UpdatePending", message)
+	}
+	if s.pendingUpdates == nil {
+		s.pendingUpdates = map[k8sclient.Target]string{}
+	}
+	s.pendingUpdates[tgt] = message
+	return reqs, true
 }
 
 func logRequirements(reqs map[string]apiv1.ResourceRequirements) {
@@ -166,38 +722,98 @@ func logRequirements(reqs map[string]apiv1.ResourceRequirements) {
 	}
 }
 
-func (s *AutoScaler) readConfigFileIfChanged() ([]byte, error) {
-	if s.configFile == "" {
-		return nil, nil
+// readConfigMapIfChanged reads the ConfigMap, and returns whether it changed
+// since the last read.
+func (s *AutoScaler) readConfigMapIfChanged() bool {
+	data, found := s.configMap.Get()
+	if s.currentConfig != nil && data == s.lastConfigMapData && found == s.lastConfigMapFound {
+		return false
 	}
+	s.lastConfigMapData, s.lastConfigMapFound = data, found
+	return true
+}
+
+// fileLayer is a layer of config read from a file.  The file is only re-read
+// when it is replaced, as happens when a mounted ConfigMap is updated, or
+// written to.
+type fileLayer struct {
+	path     string
+	lastInfo os.FileInfo
+	data     []byte
+}
 
-	fi, err := os.Stat(s.configFile)
+func (f *fileLayer) String() string {
+	return fmt.Sprintf("config file %q", f.path)
+}
+
+// readConfigFiles expands config paths into files, and reads each file which
+// is new or changed since the previous files were read.  It returns whether
+// any file changed, including by being added or removed.
+func readConfigFiles(paths []string, previousFiles []*fileLayer) ([]*fileLayer, bool, error) {
+	paths, err := ExpandConfigPaths(paths)
 	if err != nil {
-		return nil, fmt.Errorf("can't stat file %s: %v", s.configFile, err)
+		return nil, false, fmt.Errorf("failed to find config files: %v", err)
 	}
-	if os.SameFile(fi, s.lastFileInfo) {
-		return nil, nil
+	previous := map[string]*fileLayer{}
+	for _, f := range previousFiles {
+		previous[f.path] = f
 	}
-	s.lastFileInfo = fi
-	fb, err := os.ReadFile(s.configFile)
-	if err != nil {
-		return nil, fmt.Errorf("can't read file %s: %v", s.configFile, err)
+	changed := len(paths) != len(previousFiles)
+	files := make([]*fileLayer, 0, len(paths))
+	for _, path := range paths {
+		f, found := previous[path]
+		if !found {
+			f = &fileLayer{path: path}
+		}
+		fileChanged, err := f.readIfChanged()
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read %s: %v", f, err)
+		}
+		changed = changed || fileChanged
+		files = append(files, f)
 	}
-	return fb, nil
+	return files, changed, nil
 }
 
-func calculate(cfg ResourceScaleConfig, cluster *k8sclient.ClusterSize) int64 {
-	var base int64
-	if cfg.Base != nil {
-		base = asInt64(cfg.Base)
+// readIfChanged re-reads the file if it was replaced since the last read, and
+// returns whether it was.
+func (f *fileLayer) readIfChanged() (bool, error) {
+	fi, err := os.Stat(f.path)
+	if err != nil {
+		return false, err
 	}
-	var max int64
-	if cfg.Max != nil {
-		max = asInt64(cfg.Max)
+	if os.SameFile(fi, f.lastInfo) && fi.ModTime().Equal(f.lastInfo.ModTime()) && fi.Size() == f.lastInfo.Size() {
+		return false, nil
 	}
-	var step int64
-	if cfg.Step != nil {
-		step = asInt64(cfg.Step)
+	fb, err := os.ReadFile(f.path)
+	if err != nil {
+		return false, err
+	}
+	f.lastInfo, f.data = fi, fb
+	return true, nil
+}
+
+// calculate returns the quantity for the cluster size in milli-units.  When
+// the result overflows, it is the max if there is one, or else an error.
+func calculate(cfg ResourceScaleConfig, cluster *k8sclient.ClusterSize) (int64, error) {
+	var base, max, step, roundTo int64
+	for _, q := range []struct {
+		value *resource.Quantity
+		out   *int64
+	}{
+		{cfg.Base, &base},
+		{cfg.Max, &max},
+		{cfg.Step, &step},
+		{cfg.RoundTo, &roundTo},
+	} {
+		if q.value == nil {
+			continue
+		}
+		v, err := asInt64(q.value)
+		if err != nil {
+			return 0, err
+		}
+		*q.out = v
 	}
 	var cpi int
 	if cfg.CoresPerStep != nil {
@@ -207,26 +823,76 @@ func calculate(cfg ResourceScaleConfig, cluster *k8sclient.ClusterSize) int64 {
 	if cfg.NodesPerStep != nil {
 		npi = *cfg.NodesPerStep
 	}
-	wantByCores := base + (step * int64(increments(cluster.Cores, cpi)))
-	if max > 0 && wantByCores > max {
-		wantByCores = max
+	var mpi int64
+	if cfg.MemoryPerStep != nil {
+		mpi = cfg.MemoryPerStep.Value()
+	}
+	want := int64(math.MinInt64)
+	for _, incr := range []int64{int64(increments(cluster.Cores, cpi)), int64(increments(cluster.Nodes, npi)), memoryIncrements(cluster.Memory, mpi)} {
+		wantBy, ok := addSteps(base, step, incr)
+		if (!ok || wantBy > max) && max > 0 {
+			wantBy, ok = max, true
+		}
+		if !ok {
+			return 0, fmt.Errorf("%v plus %d steps of %v overflows", resource.NewMilliQuantity(base, cfg.format()), incr, cfg.Step)
+		}
+		if wantBy > want {
+			want = wantBy
+		}
+	}
+	if roundTo > 0 {
+		rounded, ok := roundUp(want, roundTo, max)
+		if !ok {
+			return 0, fmt.Errorf("rounding %v up to a multiple of %v overflows", resource.NewMilliQuantity(want, cfg.format()), cfg.RoundTo)
+		}
+		want = rounded
+	}
+	return want, nil
+}
+
+// addSteps returns base plus n steps, and false if it overflows.
+func addSteps(base, step, n int64) (int64, bool) {
+	if n == 0 || step == 0 {
+		return base, true
+	}
+	product := step * n
+	if product/n != step {
+		return 0, false
 	}
-	wantByNodes := base + (step * int64(increments(cluster.Nodes, npi)))
-	if max > 0 && wantByNodes > max {
-		wantByNodes = max
+	sum := base + product
+	if (product > 0 && sum < base) || (product < 0 && sum > base) {
+		return 0, false
 	}
-	want := wantByCores
-	if wantByNodes > want {
-		want = wantByNodes
+	return sum, true
+}
+
+// roundUp rounds up to a multiple of roundTo, but not above a non-zero max.
+// It returns false if it overflows.
+func roundUp(want, roundTo, max int64) (int64, bool) {
+	if roundTo <= 0 || want%roundTo == 0 {
+		return want, true
 	}
-	return want
+	rounded, ok := addSteps(0, roundTo, want/roundTo+1)
+	if max > 0 && (!ok || rounded > max) {
+		return max, true
+	}
+	return rounded, ok
+}
+
+// fractionalUnits returns whether a resource can be set in fractions of a
+// unit, as only cpu can.  Others, such as memory, are counted in bytes.
+func fractionalUnits(res string) bool {
+	return res == string(apiv1.ResourceCPU)
 }
 
-func asInt64(q *resource.Quantity) int64 {
-	if q.Value() > (math.MaxInt64 / int64(1000)) {
-		panic(fmt.Sprintf("can't convert quantity %s to int64 milli-units", q))
+// maxQuantity is the largest quantity which can be computed in milli-units.
+var maxQuantity = resource.NewQuantity(math.MaxInt64/1000, resource.DecimalSI)
+
+func asInt64(q *resource.Quantity) (int64, error) {
+	if q.CmpInt64(math.MaxInt64/1000) > 0 || q.CmpInt64(-math.MaxInt64/1000) < 0 {
+		return 0, fmt.Errorf("quantity %s is too large: it must not be greater than %s", q, maxQuantity)
 	}
-	return q.MilliValue()
+	return q.MilliValue(), nil
 }
 
 func increments(count int, per int) int {
@@ -239,12 +905,34 @@ func increments(count int, per int) int {
 	return (count + (per - 1)) / per
 }
 
-func guessFormat(res string) resource.Format {
-	switch res {
-	case string(apiv1.ResourceMemory), string(apiv1.ResourceStorage):
-		return resource.DecimalSI
+// memoryIncrements is like increments, for bytes of memory, which may not fit
+// in an int.
+func memoryIncrements(bytes int64, per int64) int64 {
+	if per <= 0 {
+		return 0
 	}
-	return resource.BinarySI
+	n := bytes / per
+	if bytes%per != 0 {
+		n++
+	}
+	return n
+}
+
+// Formats which a computed quantity may be written in.
+var quantityFormats = []string{string(resource.BinarySI), string(resource.DecimalSI)}
+
+// format returns the format to write a computed quantity in: the one which
+// is configured, or else the one the base, step or max is written in.
+func (rsc ResourceScaleConfig) format() resource.Format {
+	if rsc.Format != "" {
+		return resource.Format(rsc.Format)
+	}
+	for _, q := range []*resource.Quantity{rsc.Base, rsc.Step, rsc.Max} {
+		if q != nil {
+			return q.Format
+		}
+	}
+	return resource.DecimalSI
 }
 
 // ScaleConfig maps container names to per-container configs.
@@ -252,13 +940,59 @@ type ScaleConfig map[string]ContainerScaleConfig
 
 // ContainmerScaleConfig holds per-container per-resource configs.
 type ContainerScaleConfig struct {
-	Requests map[string]ResourceScaleConfig
-	Limits   map[string]ResourceScaleConfig
+	Requests map[string]ResourceScaleConfig `json:"requests,omitempty"`
+	Limits   map[string]ResourceScaleConfig `json:"limits,omitempty"`
+	// LimitRatio sets the limit of a resource to its computed request times
+	// the ratio, instead of scaling it separately.
+	LimitRatio map[string]float64 `json:"limitRatio,omitempty"`
+	// LimitEqualsRequest sets the limit of a resource to its computed request.
+	LimitEqualsRequest map[string]bool `json:"limitEqualsRequest,omitempty"`
+	// Topology scales the container with the nodes and cores of one topology
+	// domain, such as a zone, instead of the whole cluster.
+	Topology *TopologySelector `json:"topology,omitempty"`
+	// MaxAllocatableFraction caps the request of a resource at a fraction of
+	// the allocatable of the smallest node, so that it fits on every node.
+	MaxAllocatableFraction map[string]float64 `json:"maxAllocatableFraction,omitempty"`
+	// MaintenanceWindow holds changes to the resources of the container
+	// until the window opens, since they roll the pods of the target.
+	MaintenanceWindow *MaintenanceWindow `json:"maintenanceWindow,omitempty"`
+}
+
+// TopologySelector chooses the nodes which have a label, such as
+// topology.kubernetes.io/zone=us-east1-b.
+type TopologySelector struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+func (ts TopologySelector) String() string {
+	return fmt.Sprintf("%s=%s", ts.Key, ts.Value)
+}
+
+// MaintenanceWindow opens at each time of a cron schedule, such as
+// "0 2 * * 1-5" for 2am on weekdays, and stays open for the duration.
+type MaintenanceWindow struct {
+	Schedule string          `json:"schedule"`
+	Duration metav1.Duration `json:"duration"`
+	// The time zone of the schedule, such as Europe/Berlin.  Defaults to
+	// UTC.
+	TimeZone string `json:"timeZone,omitempty"`
+	// AllowScaleUp applies changes which only raise requests or limits
+	// outside the window.
+	AllowScaleUp bool `json:"allowScaleUp,omitempty"`
+}
+
+func (mw MaintenanceWindow) String() string {
+	tz := mw.TimeZone
+	if tz == "" {
+		tz = "UTC"
+	}
+	return fmt.Sprintf("%q %s for %v", mw.Schedule, tz, mw.Duration.Duration)
 }
 
 // ResourceScaleConfig holds the coefficients for a single resource scaling
-// function. The final result will be the base plus the larger of the by-cores
-// scaling and the by-nodes scaling, bounded by the max value.
+// function. The final result will be the base plus the largest of the
+// by-cores, by-nodes and by-memory scaling, bounded by the max value.
 //
 // Example:
 //   Base = 10
@@ -279,16 +1013,25 @@ type ContainerScaleConfig struct {
 //     by-nodes: 10 + (2 * (round(3, 2)/2)) = 10 + 4 = 14
 type ResourceScaleConfig struct {
 	// The baseline quantity required.
-	Base *resource.Quantity
+	Base *resource.Quantity `json:"base,omitempty"`
 	// The maximum allowed quantity.
-	Max *resource.Quantity
+	Max *resource.Quantity `json:"max,omitempty"`
 	// The amount of additional resources to grow by.  If this is too
 	// fine-grained, the resizing action will happen too frequently.
-	Step *resource.Quantity
+	Step *resource.Quantity `json:"step,omitempty"`
 	// The number of cores required to trigger an increase.
-	CoresPerStep *int
+	CoresPerStep *int `json:"coresPerStep,omitempty"`
 	// The number of nodes required to trigger an increase.
-	NodesPerStep *int
+	NodesPerStep *int `json:"nodesPerStep,omitempty"`
+	// The amount of node memory required to trigger an increase.
+	MemoryPerStep *resource.Quantity `json:"memoryPerStep,omitempty"`
+	// The quantity is rounded up to a multiple of RoundTo, but not above
+	// Max.
+	RoundTo *resource.Quantity `json:"roundTo,omitempty"`
+	// The format to write the quantity in, either BinarySI (such as 64Mi)
+	// or DecimalSI (such as 64M or 250m).  Defaults to the format of Base,
+	// Step or Max.
+	Format string `json:"format,omitempty"`
 }
 
 func (sc ScaleConfig) String() string {
@@ -311,7 +1054,23 @@ func (csc ContainerScaleConfig) String() string {
 	for k, v := range csc.Limits {
 		buf.WriteString(fmt.Sprintf("[%s]: %s", k, v))
 	}
-	buf.WriteString("} }")
+	buf.WriteString("}")
+	for k, v := range csc.LimitRatio {
+		buf.WriteString(fmt.Sprintf(", limitRatio[%s]: %g", k, v))
+	}
+	for k, v := range csc.LimitEqualsRequest {
+		buf.WriteString(fmt.Sprintf(", limitEqualsRequest[%s]: %t", k, v))
+	}
+	if csc.Topology != nil {
+		buf.WriteString(fmt.Sprintf(", topology: %s", csc.Topology))
+	}
+	for k, v := range csc.MaxAllocatableFraction {
+		buf.WriteString(fmt.Sprintf(", maxAllocatableFraction[%s]: %g", k, v))
+	}
+	if csc.MaintenanceWindow != nil {
+		buf.WriteString(fmt.Sprintf(", maintenanceWindow: %s", csc.MaintenanceWindow))
+	}
+	buf.WriteString(" }")
 	return buf.String()
 }
 
@@ -333,6 +1092,15 @@ func (rsc ResourceScaleConfig) String() string {
 	if rsc.NodesPerStep != nil {
 		buf.WriteString(fmt.Sprintf("nodes_incr=%d ", *rsc.NodesPerStep))
 	}
+	if rsc.MemoryPerStep != nil {
+		buf.WriteString(fmt.Sprintf("memory_incr=%s ", rsc.MemoryPerStep.String()))
+	}
+	if rsc.RoundTo != nil {
+		buf.WriteString(fmt.Sprintf("round_to=%s ", rsc.RoundTo.String()))
+	}
+	if rsc.Format != "" {
+		buf.WriteString(fmt.Sprintf("format=%s ", rsc.Format))
+	}
 	buf.WriteString("}")
 	return buf.String()
 }
@@ -356,6 +1124,23 @@ func (csc ContainerScaleConfig) DeepCopy() ContainerScaleConfig {
 	for k, v := range csc.Limits {
 		out.Limits[k] = v.DeepCopy()
 	}
+	if csc.LimitRatio != nil {
+		out.LimitRatio = maps.Clone(csc.LimitRatio)
+	}
+	if csc.LimitEqualsRequest != nil {
+		out.LimitEqualsRequest = maps.Clone(csc.LimitEqualsRequest)
+	}
+	if csc.Topology != nil {
+		t := *csc.Topology
+		out.Topology = &t
+	}
+	if csc.MaxAllocatableFraction != nil {
+		out.MaxAllocatableFraction = maps.Clone(csc.MaxAllocatableFraction)
+	}
+	if csc.MaintenanceWindow != nil {
+		mw := *csc.MaintenanceWindow
+		out.MaintenanceWindow = &mw
+	}
 	return out
 
 }
@@ -383,5 +1168,14 @@ func (rsc ResourceScaleConfig) DeepCopy() ResourceScaleConfig {
 		out.NodesPerStep = new(int)
 		*out.NodesPerStep = *rsc.NodesPerStep
 	}
+	if rsc.MemoryPerStep != nil {
+		q := rsc.MemoryPerStep.DeepCopy()
+		out.MemoryPerStep = &q
+	}
+	if rsc.RoundTo != nil {
+		q := rsc.RoundTo.DeepCopy()
+		out.RoundTo = &q
+	}
+	out.Format = rsc.Format
 	return out
 }
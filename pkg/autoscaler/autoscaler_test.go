@@ -17,13 +17,24 @@ limitations under the License.
 package autoscaler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
 
+	k8sclientapi "github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
 	k8sclient "github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient/testing"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
 	clocktesting "k8s.io/utils/clock/testing"
 )
 
@@ -56,7 +67,7 @@ func TestRun(t *testing.T) {
 	autoScaler := &AutoScaler{
 		k8sClient:     &mockK8s,
 		defaultConfig: cfg,
-		configFile:    asConfig,
+		configPaths:   []string{asConfig},
 		pollPeriod:    fakePollPeriod,
 		clock:         fakeClock,
 		stopCh:        make(chan struct{}),
@@ -157,7 +168,10 @@ func TestCalculatePerCores(t *testing.T) {
 		if err != nil {
 			t.Errorf("failed to get cluster size")
 		}
-		val := calculate(cfg["fake-agent"].Requests["cpu"], sz)
+		val, err := calculate(cfg["fake-agent"].Requests["cpu"], sz)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
 		if val != tt.expVal {
 			t.Errorf("expected %d got %d", tt.expVal, val)
 		}
@@ -254,9 +268,727 @@ func TestCalculatePerNodes(t *testing.T) {
 		if err != nil {
 			t.Errorf("failed to get cluster size")
 		}
-		val := calculate(cfg["fake-agent"].Requests["cpu"], sz)
+		val, err := calculate(cfg["fake-agent"].Requests["cpu"], sz)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
 		if val != tt.expVal {
 			t.Errorf("expected %d got %d", tt.expVal, val)
 		}
 	}
 }
+
+func TestCalculatePerMemory(t *testing.T) {
+	q := func(s string) *resource.Quantity {
+		v := resource.MustParse(s)
+		return &v
+	}
+	n := func(i int) *int { return &i }
+	for _, tt := range []struct {
+		name   string
+		cfg    ResourceScaleConfig
+		memory int64
+		expVal string
+	}{
+		{
+			"whole steps",
+			ResourceScaleConfig{Base: q("100Mi"), Step: q("10Mi"), MemoryPerStep: q("4Gi")},
+			16 << 30,
+			"140Mi",
+		},
+		{
+			"rounded up to the next step",
+			ResourceScaleConfig{Base: q("100Mi"), Step: q("10Mi"), MemoryPerStep: q("4Gi")},
+			17 << 30,
+			"150Mi",
+		},
+		{
+			"larger than by cores",
+			ResourceScaleConfig{Base: q("100Mi"), Step: q("10Mi"), MemoryPerStep: q("4Gi"), CoresPerStep: n(1)},
+			64 << 30,
+			"260Mi",
+		},
+		{
+			"no memory",
+			ResourceScaleConfig{Base: q("100Mi"), Step: q("10Mi"), MemoryPerStep: q("4Gi")},
+			0,
+			"100Mi",
+		},
+	} {
+		val, err := calculate(tt.cfg, &k8sclientapi.ClusterSize{Nodes: 1, Cores: 8, Memory: tt.memory})
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if exp := q(tt.expVal).MilliValue(); val != exp {
+			t.Errorf("%s: expected %d, got %d", tt.name, exp, val)
+		}
+	}
+}
+
+func TestCalculateOverflow(t *testing.T) {
+	q := func(s string) *resource.Quantity {
+		v := resource.MustParse(s)
+		return &v
+	}
+	n := func(i int) *int { return &i }
+	for _, tt := range []struct {
+		name   string
+		cfg    ResourceScaleConfig
+		expVal string
+		expErr bool
+	}{
+		{
+			"steps overflow",
+			ResourceScaleConfig{Base: q("1"), Step: q("1P"), NodesPerStep: n(1)},
+			"",
+			true,
+		},
+		{
+			"steps overflow up to the max",
+			ResourceScaleConfig{Base: q("1"), Step: q("1P"), NodesPerStep: n(1), Max: q("2P")},
+			"2P",
+			false,
+		},
+		{
+			"rounding overflows",
+			ResourceScaleConfig{Base: q("9P"), RoundTo: q("5P")},
+			"",
+			true,
+		},
+		{
+			"quantity too large",
+			ResourceScaleConfig{Base: q("1E")},
+			"",
+			true,
+		},
+	} {
+		val, err := calculate(tt.cfg, &k8sclientapi.ClusterSize{Nodes: 10000, Cores: 80000})
+		if tt.expErr {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %d", tt.name, val)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if exp := q(tt.expVal).MilliValue(); val != exp {
+			t.Errorf("%s: expected %d, got %d", tt.name, exp, val)
+		}
+	}
+}
+
+func TestPollAPIServerCalculationError(t *testing.T) {
+	cfg := ScaleConfig{}
+	if err := ParseScaleConfig([]byte(`{"thing":{"requests":{"memory":{"base":"1","step":"1P","nodesPerStep":1}}}}`), &cfg); err != nil {
+		t.Fatalf("invalid default config: %v", err)
+	}
+	tgt := k8sclientapi.Target{Kind: "Deployment", Namespace: "default", Name: "thing"}
+	mockK8s := &k8sclient.MockK8sClient{
+		NumOfNodes: 10000,
+		NumOfCores: 80000,
+		Targets:    []k8sclientapi.Target{tgt},
+	}
+	autoScaler := &AutoScaler{
+		k8sClient:     mockK8s,
+		defaultConfig: cfg,
+	}
+
+	// The error is reported once, and nothing is updated.
+	failures := testutil.ToFloat64(calculationErrors)
+	autoScaler.pollAPIServer()
+	autoScaler.pollAPIServer()
+	if len(mockK8s.Updates) != 0 {
+		t.Errorf("expected no updates, got %v", mockK8s.Updates)
+	}
+	if exp := []string{"CalculationFailed"}; !reflect.DeepEqual(mockK8s.Events[tgt], exp) {
+		t.Errorf("expected events %v, got %v", exp, mockK8s.Events[tgt])
+	}
+	if got := testutil.ToFloat64(calculationErrors) - failures; got != 2 {
+		t.Errorf("expected 2 calculation errors, got %v", got)
+	}
+
+	mockK8s.NumOfNodes = 4
+	autoScaler.pollAPIServer()
+	if _, found := mockK8s.Updates[tgt]; !found {
+		t.Errorf("expected %s to be updated once the resources can be computed", tgt)
+	}
+}
+
+func TestComputeLimitModes(t *testing.T) {
+	cfg := ScaleConfig{}
+	config := `
+coredns:
+  requests:
+    cpu: {base: 100m, step: 10m, nodesPerStep: 1}
+    memory: {base: 64Mi, step: 1Mi, nodesPerStep: 1}
+    example.com/gpu: {base: 1}
+    ephemeral-storage: {base: 1001}
+  limits:
+    example.com/gpu: {base: 2}
+  limitRatio:
+    memory: 1.5
+    ephemeral-storage: 1.5
+  limitEqualsRequest:
+    cpu: true
+`
+	if err := ParseScaleConfig([]byte(config), &cfg); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+
+	reqs, err := ComputeRequirements(cfg, &k8sclientapi.ClusterSize{Nodes: 4, Cores: 8})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, tt := range []struct {
+		res      apiv1.ResourceName
+		expLimit string
+	}{
+		{apiv1.ResourceCPU, "140m"},
+		{apiv1.ResourceMemory, "102Mi"},
+		{"example.com/gpu", "2"},
+		// Rounded up to a whole byte.
+		{apiv1.ResourceEphemeralStorage, "1502"},
+	} {
+		got := reqs["coredns"].Limits[tt.res]
+		if got.String() != tt.expLimit {
+			t.Errorf("%s: expected a limit of %s, got %v", tt.res, tt.expLimit, &got)
+		}
+	}
+}
+
+func TestComputeRounding(t *testing.T) {
+	cfg := ScaleConfig{}
+	config := `
+coredns:
+  requests:
+    cpu: {base: 100m, step: 7m, nodesPerStep: 1, roundTo: 50m}
+    memory: {base: 64Mi, step: 5Mi, nodesPerStep: 1, roundTo: 16Mi}
+    ephemeral-storage: {base: 1Gi, format: DecimalSI}
+  limits:
+    cpu: {base: 100m, step: 7m, nodesPerStep: 1, max: 120m, roundTo: 50m}
+    memory: {base: 1073741824, format: BinarySI}
+`
+	if err := ParseScaleConfig([]byte(config), &cfg); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+
+	reqs, err := ComputeRequirements(cfg, &k8sclientapi.ClusterSize{Nodes: 4, Cores: 8})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, tt := range []struct {
+		name string
+		list apiv1.ResourceList
+		res  apiv1.ResourceName
+		exp  string
+	}{
+		{"rounded up", reqs["coredns"].Requests, apiv1.ResourceCPU, "150m"},
+		{"rounded up in binary", reqs["coredns"].Requests, apiv1.ResourceMemory, "96Mi"},
+		{"decimal format", reqs["coredns"].Requests, apiv1.ResourceEphemeralStorage, "1073741824"},
+		{"rounded up to max", reqs["coredns"].Limits, apiv1.ResourceCPU, "120m"},
+		{"binary format", reqs["coredns"].Limits, apiv1.ResourceMemory, "1Gi"},
+	} {
+		got := tt.list[tt.res]
+		if got.String() != tt.exp {
+			t.Errorf("%s: expected %s, got %v", tt.name, tt.exp, &got)
+		}
+	}
+}
+
+func TestComputeTopology(t *testing.T) {
+	cfg := ScaleConfig{}
+	config := `
+coredns:
+  requests:
+    cpu: {base: 100m, step: 10m, nodesPerStep: 1}
+  topology: {key: topology.kubernetes.io/zone, value: us-east1-b}
+kube-proxy:
+  requests:
+    cpu: {base: 100m, step: 10m, nodesPerStep: 1}
+`
+	if err := ParseScaleConfig([]byte(config), &cfg); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	zone := func(z string) map[string]string {
+		return map[string]string{"topology.kubernetes.io/zone": z}
+	}
+	size := &k8sclientapi.ClusterSize{
+		Nodes: 3,
+		Cores: 12,
+		NodeSizes: []k8sclientapi.NodeSize{
+			{Labels: zone("us-east1-a"), MilliCores: 4000},
+			{Labels: zone("us-east1-a"), MilliCores: 4000},
+			{Labels: zone("us-east1-b"), MilliCores: 4000},
+		},
+	}
+
+	reqs, err := ComputeRequirements(cfg, size)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for ctr, exp := range map[string]int64{"coredns": 110, "kube-proxy": 130} {
+		got := reqs[ctr].Requests[apiv1.ResourceCPU]
+		if got.MilliValue() != exp {
+			t.Errorf("%s: expected cpu request of %dm, got %v", ctr, exp, &got)
+		}
+	}
+}
+
+func TestComputeMaxAllocatableFraction(t *testing.T) {
+	cfg := ScaleConfig{}
+	config := `
+agent:
+  requests:
+    cpu: {base: 1, step: 1, nodesPerStep: 1}
+    memory: {base: 1Gi, roundTo: 128Mi}
+    ephemeral-storage: {base: 1Gi}
+  limitEqualsRequest:
+    cpu: true
+  maxAllocatableFraction:
+    cpu: 0.5
+    memory: 0.5
+    ephemeral-storage: 0.5
+`
+	if err := ParseScaleConfig([]byte(config), &cfg); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	allocatable := func(cpu, memory string) apiv1.ResourceList {
+		return apiv1.ResourceList{
+			apiv1.ResourceCPU:              resource.MustParse(cpu),
+			apiv1.ResourceMemory:           resource.MustParse(memory),
+			apiv1.ResourceEphemeralStorage: resource.MustParse("1000000001"),
+		}
+	}
+
+	for _, tt := range []struct {
+		name      string
+		size      *k8sclientapi.ClusterSize
+		expCPU    string
+		expMemory string
+	}{
+		{
+			"capped by the smallest node",
+			&k8sclientapi.ClusterSize{Nodes: 3, Cores: 20, NodeSizes: []k8sclientapi.NodeSize{
+				{Allocatable: allocatable("15500m", "60Gi")},
+				{Allocatable: allocatable("1930m", "7Gi")},
+				{Allocatable: allocatable("3920m", "1Gi")},
+			}},
+			"965m", "512Mi",
+		},
+		{
+			"capped to a multiple of roundTo",
+			&k8sclientapi.ClusterSize{Nodes: 1, Cores: 16, NodeSizes: []k8sclientapi.NodeSize{
+				{Allocatable: allocatable("15500m", "1000000001")},
+			}},
+			"2", "384Mi",
+		},
+		{
+			"below the cap",
+			&k8sclientapi.ClusterSize{Nodes: 1, Cores: 16, NodeSizes: []k8sclientapi.NodeSize{
+				{Allocatable: allocatable("15500m", "60Gi")},
+			}},
+			"2", "1Gi",
+		},
+		{
+			"no node sizes",
+			&k8sclientapi.ClusterSize{Nodes: 3, Cores: 20},
+			"4", "1Gi",
+		},
+	} {
+		reqs, err := ComputeRequirements(cfg, tt.size)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		res := reqs["agent"]
+		cpu, memory, limit := res.Requests[apiv1.ResourceCPU], res.Requests[apiv1.ResourceMemory], res.Limits[apiv1.ResourceCPU]
+		if cpu.String() != tt.expCPU || memory.String() != tt.expMemory {
+			t.Errorf("%s: expected cpu %s and memory %s, got %s and %s", tt.name, tt.expCPU, tt.expMemory, &cpu, &memory)
+		}
+		// Derived limits follow the capped request.
+		if limit.Cmp(cpu) != 0 {
+			t.Errorf("%s: expected cpu limit %s, got %s", tt.name, &cpu, &limit)
+		}
+		// A cap on bytes is rounded down to a whole byte.
+		if storage := res.Requests[apiv1.ResourceEphemeralStorage]; len(tt.size.NodeSizes) > 0 && storage.String() != "500000000" {
+			t.Errorf("%s: expected ephemeral-storage 500000000, got %s", tt.name, &storage)
+		}
+	}
+}
+
+func TestPollAPIServerTargets(t *testing.T) {
+	cfg := ScaleConfig{}
+	if err := json.Unmarshal([]byte(`{"thing":{"requests":{"cpu":{"base":"10m","step":"1m","nodesPerStep":1}}}}`), &cfg); err != nil {
+		t.Fatalf("invalid default config: %v", err)
+	}
+	tenantA := k8sclientapi.Target{Kind: "Deployment", Namespace: "tenant-a", Name: "thing"}
+	tenantB := k8sclientapi.Target{Kind: "Deployment", Namespace: "tenant-b", Name: "thing"}
+	mockK8s := &k8sclient.MockK8sClient{
+		NumOfNodes: 4,
+		NumOfCores: 8,
+		Targets:    []k8sclientapi.Target{tenantA},
+	}
+	autoScaler := &AutoScaler{
+		k8sClient:     mockK8s,
+		defaultConfig: cfg,
+	}
+
+	autoScaler.pollAPIServer()
+	if len(mockK8s.Updates) != 1 {
+		t.Fatalf("expected 1 updated target, got %v", mockK8s.Updates)
+	}
+	got := mockK8s.Updates[tenantA]["thing"].Requests[apiv1.ResourceCPU]
+	if got.MilliValue() != 14 {
+		t.Errorf("expected cpu request of 14m, got %v", &got)
+	}
+
+	// A newly created target is picked up, and the unchanged one is not
+	// patched again.
+	mockK8s.Updates = nil
+	mockK8s.Targets = append(mockK8s.Targets, tenantB)
+	autoScaler.pollAPIServer()
+	if _, found := mockK8s.Updates[tenantA]; found {
+		t.Errorf("expected %s not to be updated again", tenantA)
+	}
+	if _, found := mockK8s.Updates[tenantB]; !found {
+		t.Errorf("expected %s to be updated", tenantB)
+	}
+}
+
+func TestPollAPIServerUpdateCooldown(t *testing.T) {
+	cfg := ScaleConfig{}
+	if err := json.Unmarshal([]byte(`{"thing":{"requests":{"cpu":{"base":"10m","step":"1m","nodesPerStep":1}}}}`), &cfg); err != nil {
+		t.Fatalf("invalid default config: %v", err)
+	}
+	tgt := k8sclientapi.Target{Kind: "Deployment", Namespace: "default", Name: "thing"}
+	mockK8s := &k8sclient.MockK8sClient{
+		NumOfNodes: 4,
+		NumOfCores: 8,
+		Targets:    []k8sclientapi.Target{tgt},
+	}
+	fakeClock := clocktesting.NewFakeClock(time.Now())
+	autoScaler := &AutoScaler{
+		k8sClient:      mockK8s,
+		defaultConfig:  cfg,
+		clock:          fakeClock,
+		updateCooldown: 30 * time.Minute,
+	}
+
+	autoScaler.pollAPIServer()
+	if got := mockK8s.Updates[tgt]["thing"].Requests[apiv1.ResourceCPU]; got.MilliValue() != 14 {
+		t.Fatalf("expected cpu request of 14m, got %v", &got)
+	}
+
+	// Changes during the cooldown are not applied.
+	mockK8s.Updates = nil
+	for _, nodes := range []int{5, 6} {
+		fakeClock.Step(10 * time.Minute)
+		mockK8s.NumOfNodes = nodes
+		autoScaler.pollAPIServer()
+		if len(mockK8s.Updates) != 0 {
+			t.Errorf("expected no updates during the cooldown, got %v", mockK8s.Updates)
+		}
+	}
+
+	// Then only the latest is.
+	fakeClock.Step(10 * time.Minute)
+	autoScaler.pollAPIServer()
+	if got := mockK8s.Updates[tgt]["thing"].Requests[apiv1.ResourceCPU]; got.MilliValue() != 16 {
+		t.Errorf("expected cpu request of 16m after the cooldown, got %v", &got)
+	}
+}
+
+func TestPollAPIServerUpdateCooldownRestart(t *testing.T) {
+	cfg := ScaleConfig{}
+	if err := json.Unmarshal([]byte(`{"thing":{"requests":{"cpu":{"base":"10m","step":"1m","nodesPerStep":1}}}}`), &cfg); err != nil {
+		t.Fatalf("invalid default config: %v", err)
+	}
+	tgt := k8sclientapi.Target{Kind: "Deployment", Namespace: "default", Name: "thing"}
+	fakeClock := clocktesting.NewFakeClock(time.Now())
+	// Updated by a previous run of cpvpa.
+	mockK8s := &k8sclient.MockK8sClient{
+		NumOfNodes:  4,
+		NumOfCores:  8,
+		Targets:     []k8sclientapi.Target{tgt},
+		LastUpdated: map[k8sclientapi.Target]time.Time{tgt: fakeClock.Now().Add(-20 * time.Minute)},
+	}
+	autoScaler := &AutoScaler{
+		k8sClient:      mockK8s,
+		defaultConfig:  cfg,
+		clock:          fakeClock,
+		updateCooldown: 30 * time.Minute,
+	}
+
+	autoScaler.pollAPIServer()
+	if len(mockK8s.Updates) != 0 {
+		t.Errorf("expected no updates during the cooldown recorded on the target, got %v", mockK8s.Updates)
+	}
+	fakeClock.Step(10 * time.Minute)
+	autoScaler.pollAPIServer()
+	if got := mockK8s.Updates[tgt]["thing"].Requests[apiv1.ResourceCPU]; got.MilliValue() != 14 {
+		t.Errorf("expected cpu request of 14m after the cooldown, got %v", &got)
+	}
+}
+
+func TestScaleAnnotatedTargets(t *testing.T) {
+	good := k8sclientapi.Target{Kind: "Deployment", Namespace: "default", Name: "good", UID: "1"}
+	bad := k8sclientapi.Target{Kind: "Deployment", Namespace: "default", Name: "bad", UID: "2"}
+	mockK8s := &k8sclient.MockK8sClient{
+		NumOfNodes: 4,
+		NumOfCores: 8,
+		Configs: map[k8sclientapi.Target]string{
+			good: `{"good":{"requests":{"memory":{"base":"8Mi","step":"1Mi","coresPerStep":2}}}}`,
+			bad:  `{"bad":{"requests":`,
+		},
+	}
+	autoScaler := &AutoScaler{
+		k8sClient:        mockK8s,
+		annotatedTargets: true,
+	}
+
+	autoScaler.pollAPIServer()
+	autoScaler.pollAPIServer()
+	got := mockK8s.Updates[good]["good"].Requests[apiv1.ResourceMemory]
+	if got.Value() != 12*1024*1024 {
+		t.Errorf("expected memory request of 12Mi, got %v", &got)
+	}
+	if _, found := mockK8s.Updates[bad]; found {
+		t.Errorf("expected %s not to be updated", bad)
+	}
+	// The bad config is only reported once, even though it was seen twice.
+	if !reflect.DeepEqual(mockK8s.Events[bad], []string{"InvalidConfig"}) {
+		t.Errorf("expected one InvalidConfig event for %s, got %v", bad, mockK8s.Events[bad])
+	}
+	if len(mockK8s.Events[good]) != 0 {
+		t.Errorf("expected no events for %s, got %v", good, mockK8s.Events[good])
+	}
+}
+
+func TestConfigMapConfig(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	watcher, err := k8sclientapi.NewConfigMapWatcher(client, "default", "thing-config", "config.json", stopCh)
+	if err != nil {
+		t.Fatalf("failed to watch ConfigMap: %v", err)
+	}
+	defaultConfig := ScaleConfig{}
+	if err := json.Unmarshal([]byte(`{"thing":{"requests":{"cpu":{"base":"10m"}}}}`), &defaultConfig); err != nil {
+		t.Fatalf("invalid default config: %v", err)
+	}
+	tgt := k8sclientapi.Target{Kind: "Deployment", Namespace: "default", Name: "thing"}
+	mockK8s := &k8sclient.MockK8sClient{
+		NumOfNodes: 4,
+		NumOfCores: 8,
+		Targets:    []k8sclientapi.Target{tgt},
+	}
+	autoScaler := &AutoScaler{
+		k8sClient:     mockK8s,
+		defaultConfig: defaultConfig,
+		configMap:     watcher,
+	}
+	expectCPU := func(when string, expMilli int64) {
+		autoScaler.pollAPIServer()
+		got := mockK8s.Updates[tgt]["thing"].Requests[apiv1.ResourceCPU]
+		if got.MilliValue() != expMilli {
+			t.Errorf("%s: expected cpu request of %dm, got %v", when, expMilli, &got)
+		}
+	}
+	waitForChange := func() {
+		select {
+		case <-watcher.Changed():
+		case <-time.After(wait.ForeverTestTimeout):
+			t.Fatalf("timed out waiting for the ConfigMap to change")
+		}
+	}
+
+	expectCPU("without the ConfigMap", 10)
+
+	cm := &apiv1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "thing-config"},
+		Data:       map[string]string{"config.json": `{"thing":{"requests":{"cpu":{"base":"20m"}}}}`},
+	}
+	if _, err := client.CoreV1().ConfigMaps("default").Create(context.TODO(), cm, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("failed to create ConfigMap: %v", err)
+	}
+	waitForChange()
+	expectCPU("with the ConfigMap", 20)
+
+	cm.Data = nil
+	if _, err := client.CoreV1().ConfigMaps("default").Update(context.TODO(), cm, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("failed to update ConfigMap: %v", err)
+	}
+	waitForChange()
+	expectCPU("without the key", 10)
+}
+
+func TestConfigLayers(t *testing.T) {
+	dir := t.TempDir()
+	// Files are replaced rather than rewritten, as the kubelet does for
+	// mounted ConfigMaps.
+	writeFile := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	defaultConfig := ScaleConfig{}
+	if err := ParseScaleConfig([]byte(`{"thing":{"requests":{"cpu":{"base":"10m"},"memory":{"base":"8Mi"}}}}`), &defaultConfig); err != nil {
+		t.Fatalf("invalid default config: %v", err)
+	}
+	configFile := writeFile("config.yaml", "thing:\n  requests:\n    cpu: {base: 20m}\n")
+	overlay := writeFile("overlay.yaml", "thing:\n  requests:\n    memory: null\n")
+
+	tgt := k8sclientapi.Target{Kind: "Deployment", Namespace: "default", Name: "thing"}
+	mockK8s := &k8sclient.MockK8sClient{
+		NumOfNodes: 4,
+		NumOfCores: 8,
+		Targets:    []k8sclientapi.Target{tgt},
+	}
+	autoScaler := &AutoScaler{
+		k8sClient:     mockK8s,
+		defaultConfig: defaultConfig,
+		configPaths:   []string{configFile},
+		configOverlay: overlay,
+	}
+
+	autoScaler.pollAPIServer()
+	requests := mockK8s.Updates[tgt]["thing"].Requests
+	if cpu := requests[apiv1.ResourceCPU]; cpu.MilliValue() != 20 {
+		t.Errorf("expected the config file to set a cpu request of 20m, got %v", &cpu)
+	}
+	if memory, found := requests[apiv1.ResourceMemory]; found {
+		t.Errorf("expected the overlay to remove the memory request, got %v", &memory)
+	}
+
+	writeFile("overlay.yaml", "thing:\n  requests:\n    cpu: {base: 30m}\n")
+	autoScaler.pollAPIServer()
+	requests = mockK8s.Updates[tgt]["thing"].Requests
+	if cpu := requests[apiv1.ResourceCPU]; cpu.MilliValue() != 30 {
+		t.Errorf("expected the new overlay to set a cpu request of 30m, got %v", &cpu)
+	}
+	if memory := requests[apiv1.ResourceMemory]; memory.Value() != 8*1024*1024 {
+		t.Errorf("expected the default memory request of 8Mi, got %v", &memory)
+	}
+}
+
+func TestConfigDirectory(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.yaml")
+	if err := os.WriteFile(base, []byte("thing:\n  requests:\n    cpu: {base: 10m}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	overrides := filepath.Join(dir, "overrides")
+	if err := os.Mkdir(overrides, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tgt := k8sclientapi.Target{Kind: "Deployment", Namespace: "default", Name: "thing"}
+	mockK8s := &k8sclient.MockK8sClient{
+		NumOfNodes: 4,
+		NumOfCores: 8,
+		Targets:    []k8sclientapi.Target{tgt},
+	}
+	autoScaler := &AutoScaler{
+		k8sClient:   mockK8s,
+		configPaths: []string{base, overrides},
+	}
+	expectCPU := func(when string, expMilli int64) {
+		autoScaler.pollAPIServer()
+		got := mockK8s.Updates[tgt]["thing"].Requests[apiv1.ResourceCPU]
+		if got.MilliValue() != expMilli {
+			t.Errorf("%s: expected cpu request of %dm, got %v", when, expMilli, &got)
+		}
+	}
+
+	expectCPU("with an empty directory", 10)
+
+	for i, name := range []string{"20-cluster.yaml", "10-region.yaml"} {
+		data := fmt.Sprintf("thing:\n  requests:\n    cpu: {base: %dm}\n", 20+i*10)
+		if err := os.WriteFile(filepath.Join(overrides, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectCPU("with files added", 20)
+
+	if err := os.Remove(filepath.Join(overrides, "20-cluster.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	expectCPU("with a file removed", 30)
+}
+
+func TestKeepLastGoodConfig(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig := func(data string) {
+		if err := os.WriteFile(configFile, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeConfig("thing:\n  requests:\n    cpu: {base: 10m, step: 1m, nodesPerStep: 1}\n")
+
+	tgt := k8sclientapi.Target{Kind: "Deployment", Namespace: "default", Name: "thing"}
+	mockK8s := &k8sclient.MockK8sClient{
+		NumOfNodes: 4,
+		NumOfCores: 8,
+		Targets:    []k8sclientapi.Target{tgt},
+	}
+	autoScaler := &AutoScaler{
+		k8sClient:   mockK8s,
+		configPaths: []string{configFile},
+	}
+	expectCPU := func(when string, expMilli int64) {
+		autoScaler.pollAPIServer()
+		got := mockK8s.Updates[tgt]["thing"].Requests[apiv1.ResourceCPU]
+		if got.MilliValue() != expMilli {
+			t.Errorf("%s: expected cpu request of %dm, got %v", when, expMilli, &got)
+		}
+	}
+
+	expectReady := func(when string, expReady bool, expEvents []string) {
+		if err := autoScaler.Ready(); (err == nil) != expReady {
+			t.Errorf("%s: expected ready to be %t, got %v", when, expReady, err)
+		}
+		if valid := testutil.ToFloat64(configLastReloadSuccessful) == 1; valid != expReady {
+			t.Errorf("%s: expected the last reload successful metric to be %t", when, expReady)
+		}
+		if !reflect.DeepEqual(mockK8s.Events[tgt], expEvents) {
+			t.Errorf("%s: expected events %v, got %v", when, expEvents, mockK8s.Events[tgt])
+		}
+	}
+
+	if err := autoScaler.Ready(); err == nil {
+		t.Errorf("expected not to be ready before the config is loaded")
+	}
+	expectCPU("with a good config", 14)
+	expectReady("with a good config", true, nil)
+
+	// The cluster keeps being scaled with the last good config, and each
+	// new error is reported once.
+	failures := testutil.ToFloat64(configReloadFailures)
+	writeConfig("thing:\n  requests:\n    cpu: {base: 10m, step: -1m}\n")
+	mockK8s.NumOfNodes = 5
+	expectCPU("with a bad config", 15)
+	expectCPU("with a bad config again", 15)
+	expectReady("with a bad config", false, []string{"InvalidConfig"})
+
+	if err := os.Remove(configFile); err != nil {
+		t.Fatal(err)
+	}
+	mockK8s.NumOfNodes = 6
+	expectCPU("without a config file", 16)
+	expectReady("without a config file", false, []string{"InvalidConfig", "InvalidConfig"})
+	if got := testutil.ToFloat64(configReloadFailures) - failures; got != 2 {
+		t.Errorf("expected 2 reload failures, got %v", got)
+	}
+
+	writeConfig("thing:\n  requests:\n    cpu: {base: 20m, step: 1m, nodesPerStep: 1}\n")
+	expectCPU("with a fixed config", 26)
+	expectReady("with a fixed config", true, []string{"InvalidConfig", "InvalidConfig", "ConfigRecovered"})
+}
@@ -0,0 +1,744 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// The fields of each level of a config.  Like encoding/json, they are matched
+// without regard to case.
+var (
+	containerFields = []string{"requests", "limits", "limitRatio", "limitEqualsRequest", "topology", "maxAllocatableFraction", "maintenanceWindow"}
+	topologyFields  = []string{"key", "value"}
+	windowFields    = []string{"schedule", "duration", "timeZone", "allowScaleUp"}
+	quantityFields  = []string{"base", "max", "step", "roundTo", "memoryPerStep"}
+	perStepFields   = []string{"coresPerStep", "nodesPerStep"}
+	resourceFields  = append(append(append([]string{}, quantityFields...), perStepFields...), "format")
+)
+
+// standardResources are the resource names which need no domain prefix.
+var standardResources = []apiv1.ResourceName{
+	apiv1.ResourceCPU,
+	apiv1.ResourceMemory,
+	apiv1.ResourceStorage,
+	apiv1.ResourceEphemeralStorage,
+}
+
+// LoadConfig returns the default config with each config file layered over it
+// in turn, in the same way as each poll of the autoscaler.
+func LoadConfig(defaultConfig string, configFiles ...string) (ScaleConfig, error) {
+	cfg := ScaleConfig{}
+	if defaultConfig != "" {
+		if err := ParseScaleConfig([]byte(defaultConfig), &cfg); err != nil {
+			return nil, fmt.Errorf("invalid default config: %w", err)
+		}
+	}
+	for _, configFile := range configFiles {
+		data, err := os.ReadFile(configFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := ParseScaleConfig(data, &cfg); err != nil {
+			return nil, fmt.Errorf("invalid config file %s: %w", configFile, err)
+		}
+	}
+	return cfg, nil
+}
+
+// ExpandConfigPaths replaces each directory in a list of config paths with the
+// JSON and YAML files in it, in order of their names.  Hidden files are
+// skipped, which includes the bookkeeping of a mounted ConfigMap.
+func ExpandConfigPaths(paths []string) ([]string, error) {
+	files := []string{}
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if strings.HasPrefix(name, ".") {
+				continue
+			}
+			switch filepath.Ext(name) {
+			case ".json", ".yaml", ".yml":
+			default:
+				continue
+			}
+			// ConfigMap keys are symlinks, so follow them.
+			file := filepath.Join(path, name)
+			if fi, err := os.Stat(file); err != nil || fi.IsDir() {
+				continue
+			}
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// ParseScaleConfig decodes a layer of config in either JSON or YAML format,
+// and merges it over cfg.  YAML is converted to JSON first, so both formats
+// share the same field names and quantity syntax.
+//
+// Containers are merged, and each resource in the layer replaces the same
+// resource of the container in cfg.  A null container, requests, limits or
+// resource removes it from cfg.
+//
+// The layer is rejected, leaving cfg unchanged, if it has unknown fields or
+// the merged config fails ValidateScaleConfig.
+func ParseScaleConfig(data []byte, cfg *ScaleConfig) error {
+	// JSON is passed through unchanged, so its errors keep their offsets.
+	jsonData, err := yaml.ToJSON(data)
+	if err != nil {
+		return err
+	}
+
+	// Check the structure first, as encoding/json ignores unknown fields and
+	// does not say where a bad quantity is.  Numbers are kept as written, so
+	// that quantities don't lose precision.
+	var raw interface{}
+	dec := json.NewDecoder(bytes.NewReader(jsonData))
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil && err != io.EOF {
+		return err
+	}
+	errs := validateRawConfig(raw)
+
+	merged, err := mergeRawConfig(*cfg, raw)
+	if err != nil {
+		if len(errs) > 0 {
+			return errs.ToAggregate()
+		}
+		return err
+	}
+	errs = append(errs, ValidateScaleConfig(merged, nil)...)
+	if len(errs) > 0 {
+		return errs.ToAggregate()
+	}
+	*cfg = merged
+	return nil
+}
+
+// mergeRawConfig returns a copy of cfg with a decoded layer of config merged
+// over it.
+func mergeRawConfig(cfg ScaleConfig, raw interface{}) (ScaleConfig, error) {
+	out := cfg.DeepCopy()
+	ctrs, _ := raw.(map[string]interface{})
+	for ctr, ctrRaw := range ctrs {
+		if ctrRaw == nil {
+			delete(out, ctr)
+			continue
+		}
+		ctrcfg, found := out[ctr]
+		if !found {
+			ctrcfg = ContainerScaleConfig{
+				Requests: map[string]ResourceScaleConfig{},
+				Limits:   map[string]ResourceScaleConfig{},
+			}
+		}
+		fields, ok := ctrRaw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("config of container %s is not an object", ctr)
+		}
+		for name, resourcesRaw := range fields {
+			if strings.EqualFold(name, "topology") {
+				if err := mergeRawTopology(&ctrcfg, resourcesRaw); err != nil {
+					return nil, fmt.Errorf("invalid topology of container %s: %v", ctr, err)
+				}
+				continue
+			}
+			if strings.EqualFold(name, "maintenanceWindow") {
+				if err := mergeRawMaintenanceWindow(&ctrcfg, resourcesRaw); err != nil {
+					return nil, fmt.Errorf("invalid maintenanceWindow of container %s: %v", ctr, err)
+				}
+				continue
+			}
+			if strings.EqualFold(name, "maxAllocatableFraction") {
+				if err := mergeRawFractions(&ctrcfg.MaxAllocatableFraction, resourcesRaw); err != nil {
+					return nil, fmt.Errorf("invalid %s of container %s: %v", name, ctr, err)
+				}
+				continue
+			}
+			if isField(name, []string{"limitRatio", "limitEqualsRequest"}) {
+				if err := mergeRawLimitModes(&ctrcfg, name, resourcesRaw); err != nil {
+					return nil, fmt.Errorf("invalid %s of container %s: %v", name, ctr, err)
+				}
+				continue
+			}
+			resources := ctrcfg.Requests
+			if strings.EqualFold(name, "limits") {
+				resources = ctrcfg.Limits
+			}
+			if resourcesRaw == nil {
+				clear(resources)
+				continue
+			}
+			resourceMap, ok := resourcesRaw.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s of container %s is not an object", name, ctr)
+			}
+			for res, rescfgRaw := range resourceMap {
+				if rescfgRaw == nil {
+					delete(resources, res)
+					continue
+				}
+				// Round trip through JSON, to decode quantities in the same way
+				// as everywhere else.
+				rescfgData, err := json.Marshal(rescfgRaw)
+				if err != nil {
+					return nil, err
+				}
+				rescfg := ResourceScaleConfig{}
+				if err := json.Unmarshal(rescfgData, &rescfg); err != nil {
+					return nil, fmt.Errorf("invalid config of %s %s of container %s: %v", name, res, ctr, err)
+				}
+				resources[res] = rescfg
+			}
+		}
+		out[ctr] = ctrcfg
+	}
+	return out, nil
+}
+
+// mergeRawTopology replaces the topology of a container config, or removes
+// it if null.
+func mergeRawTopology(ctrcfg *ContainerScaleConfig, raw interface{}) error {
+	if raw == nil {
+		ctrcfg.Topology = nil
+		return nil
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	topology := &TopologySelector{}
+	if err := json.Unmarshal(data, topology); err != nil {
+		return err
+	}
+	ctrcfg.Topology = topology
+	return nil
+}
+
+// mergeRawMaintenanceWindow replaces the maintenance window of a container
+// config, or removes it if null.
+func mergeRawMaintenanceWindow(ctrcfg *ContainerScaleConfig, raw interface{}) error {
+	if raw == nil {
+		ctrcfg.MaintenanceWindow = nil
+		return nil
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	window := &MaintenanceWindow{}
+	if err := json.Unmarshal(data, window); err != nil {
+		return err
+	}
+	ctrcfg.MaintenanceWindow = window
+	return nil
+}
+
+// mergeRawLimitModes merges a decoded limitRatio or limitEqualsRequest over a
+// container config.  Like resources, null removes one or all of them.
+func mergeRawLimitModes(ctrcfg *ContainerScaleConfig, name string, raw interface{}) error {
+	ratio := strings.EqualFold(name, "limitRatio")
+	if raw == nil {
+		if ratio {
+			ctrcfg.LimitRatio = nil
+		} else {
+			ctrcfg.LimitEqualsRequest = nil
+		}
+		return nil
+	}
+	modes, ok := raw.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("not an object")
+	}
+	for res, value := range modes {
+		switch {
+		case value == nil:
+			if ratio {
+				delete(ctrcfg.LimitRatio, res)
+			} else {
+				delete(ctrcfg.LimitEqualsRequest, res)
+			}
+		case ratio:
+			n, ok := value.(json.Number)
+			if !ok {
+				return fmt.Errorf("%s is not a number", res)
+			}
+			f, err := n.Float64()
+			if err != nil {
+				return fmt.Errorf("%s: %v", res, err)
+			}
+			if ctrcfg.LimitRatio == nil {
+				ctrcfg.LimitRatio = map[string]float64{}
+			}
+			ctrcfg.LimitRatio[res] = f
+		default:
+			b, ok := value.(bool)
+			if !ok {
+				return fmt.Errorf("%s is not a boolean", res)
+			}
+			if ctrcfg.LimitEqualsRequest == nil {
+				ctrcfg.LimitEqualsRequest = map[string]bool{}
+			}
+			ctrcfg.LimitEqualsRequest[res] = b
+		}
+	}
+	return nil
+}
+
+// mergeRawFractions merges a decoded map of resource names to numbers over
+// fractions.  Like resources, null removes one or all of them.
+func mergeRawFractions(fractions *map[string]float64, raw interface{}) error {
+	if raw == nil {
+		*fractions = nil
+		return nil
+	}
+	values, ok := raw.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("not an object")
+	}
+	for res, value := range values {
+		if value == nil {
+			delete(*fractions, res)
+			continue
+		}
+		n, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s is not a number", res)
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return fmt.Errorf("%s: %v", res, err)
+		}
+		if *fractions == nil {
+			*fractions = map[string]float64{}
+		}
+		(*fractions)[res] = f
+	}
+	return nil
+}
+
+// ValidateScaleConfig checks that every resource of a config is named like a
+// Kubernetes resource and has coefficients which make sense together.
+func ValidateScaleConfig(cfg ScaleConfig, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for ctr, ctrcfg := range cfg {
+		ctrPath := fldPath.Child(ctr)
+		for _, msg := range validation.IsDNS1123Label(ctr) {
+			allErrs = append(allErrs, field.Invalid(ctrPath, ctr, msg))
+		}
+		for res, rescfg := range ctrcfg.Requests {
+			allErrs = append(allErrs, validateResourceScaleConfig(res, rescfg, ctrPath.Child("requests", res))...)
+		}
+		for res, rescfg := range ctrcfg.Limits {
+			allErrs = append(allErrs, validateResourceScaleConfig(res, rescfg, ctrPath.Child("limits", res))...)
+		}
+		allErrs = append(allErrs, validateLimitModes(ctrcfg, ctrPath)...)
+		for res, fraction := range ctrcfg.MaxAllocatableFraction {
+			resPath := ctrPath.Child("maxAllocatableFraction", res)
+			allErrs = append(allErrs, validateResourceName(res, resPath)...)
+			if _, found := ctrcfg.Requests[res]; !found {
+				allErrs = append(allErrs, field.Invalid(resPath, fraction, fmt.Sprintf("requires requests.%s to cap", res)))
+			}
+			if fraction <= 0 || fraction > 1 {
+				allErrs = append(allErrs, field.Invalid(resPath, fraction, "must be greater than 0 and at most 1"))
+			}
+		}
+		if ctrcfg.Topology != nil {
+			allErrs = append(allErrs, validateTopology(*ctrcfg.Topology, ctrPath.Child("topology"))...)
+		}
+		if ctrcfg.MaintenanceWindow != nil {
+			allErrs = append(allErrs, validateMaintenanceWindow(*ctrcfg.MaintenanceWindow, ctrPath.Child("maintenanceWindow"))...)
+		}
+	}
+	return allErrs
+}
+
+// validateTopology checks that a topology is a node label.
+func validateTopology(topology TopologySelector, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if topology.Key == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("key"), "a node label key, such as topology.kubernetes.io/zone, is required"))
+	} else {
+		for _, msg := range validation.IsQualifiedName(topology.Key) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("key"), topology.Key, msg))
+		}
+	}
+	for _, msg := range validation.IsValidLabelValue(topology.Value) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("value"), topology.Value, msg))
+	}
+	return allErrs
+}
+
+// validateMaintenanceWindow checks that a window has a valid schedule, time
+// zone and duration.
+func validateMaintenanceWindow(window MaintenanceWindow, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if window.Schedule == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("schedule"), "a cron schedule, such as \"0 2 * * 1-5\", is required"))
+	} else if _, err := parseSchedule(window.Schedule); err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("schedule"), window.Schedule, err.Error()))
+	}
+	if window.Duration.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("duration"), window.Duration.Duration.String(), "must be greater than zero"))
+	}
+	if _, err := time.LoadLocation(window.TimeZone); err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("timeZone"), window.TimeZone, err.Error()))
+	}
+	return allErrs
+}
+
+// validateLimitModes checks that each limit derived from a request has a
+// request to derive it from, and is not also configured in another way.
+func validateLimitModes(ctrcfg ContainerScaleConfig, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	validateDerived := func(res string, resPath *field.Path, value interface{}) {
+		allErrs = append(allErrs, validateResourceName(res, resPath)...)
+		if _, found := ctrcfg.Requests[res]; !found {
+			allErrs = append(allErrs, field.Invalid(resPath, value, fmt.Sprintf("requires requests.%s to derive the limit from", res)))
+		}
+		if _, found := ctrcfg.Limits[res]; found {
+			allErrs = append(allErrs, field.Forbidden(resPath, fmt.Sprintf("may not be set along with limits.%s", res)))
+		}
+	}
+	for res, ratio := range ctrcfg.LimitRatio {
+		resPath := fldPath.Child("limitRatio", res)
+		validateDerived(res, resPath, ratio)
+		// A limit less than the request is rejected by the API server.
+		if ratio < 1 {
+			allErrs = append(allErrs, field.Invalid(resPath, ratio, "must be at least 1"))
+		}
+	}
+	for res, equal := range ctrcfg.LimitEqualsRequest {
+		if !equal {
+			continue
+		}
+		resPath := fldPath.Child("limitEqualsRequest", res)
+		validateDerived(res, resPath, equal)
+		if _, found := ctrcfg.LimitRatio[res]; found {
+			allErrs = append(allErrs, field.Forbidden(resPath, fmt.Sprintf("may not be set along with limitRatio.%s", res)))
+		}
+	}
+	return allErrs
+}
+
+func validateResourceScaleConfig(res string, cfg ResourceScaleConfig, fldPath *field.Path) field.ErrorList {
+	allErrs := validateResourceName(res, fldPath)
+
+	for _, q := range []struct {
+		name  string
+		value *resource.Quantity
+	}{
+		{"base", cfg.Base},
+		{"max", cfg.Max},
+		{"step", cfg.Step},
+		{"roundTo", cfg.RoundTo},
+		{"memoryPerStep", cfg.MemoryPerStep},
+	} {
+		if q.value != nil && q.value.Sign() < 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child(q.name), q.value.String(), "must not be negative"))
+		}
+		// Quantities are computed in milli-units, which must not overflow.
+		if q.value != nil && q.value.Cmp(*maxQuantity) > 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child(q.name), q.value.String(),
+				fmt.Sprintf("must not be greater than %s", maxQuantity)))
+		}
+	}
+	for _, n := range []struct {
+		name  string
+		value *int
+	}{
+		{"coresPerStep", cfg.CoresPerStep},
+		{"nodesPerStep", cfg.NodesPerStep},
+	} {
+		if n.value != nil && *n.value < 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child(n.name), *n.value, "must not be negative"))
+		}
+	}
+
+	// A max of zero means there is no max.
+	if cfg.Base != nil && cfg.Max != nil && cfg.Max.Sign() > 0 && cfg.Max.Cmp(*cfg.Base) < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("max"), cfg.Max.String(),
+			fmt.Sprintf("must not be less than base (%s)", cfg.Base)))
+	}
+
+	if cfg.Format != "" && !slices.Contains(quantityFormats, cfg.Format) {
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("format"), cfg.Format, quantityFormats))
+	}
+
+	hasStep := cfg.Step != nil && cfg.Step.Sign() != 0
+	hasPerStep := (cfg.CoresPerStep != nil && *cfg.CoresPerStep != 0) || (cfg.NodesPerStep != nil && *cfg.NodesPerStep != 0) ||
+		(cfg.MemoryPerStep != nil && cfg.MemoryPerStep.Sign() != 0)
+	if hasStep && !hasPerStep {
+		allErrs = append(allErrs, field.Required(fldPath.Child("coresPerStep"), "coresPerStep, nodesPerStep or memoryPerStep is required with a step"))
+	}
+	if hasPerStep && !hasStep {
+		allErrs = append(allErrs, field.Required(fldPath.Child("step"), "a step greater than zero is required with coresPerStep, nodesPerStep or memoryPerStep"))
+	}
+	return allErrs
+}
+
+// validateResourceName accepts the standard resources, hugepages, and
+// extended resources such as example.com/gpu.
+func validateResourceName(res string, fldPath *field.Path) field.ErrorList {
+	if strings.Contains(res, "/") || strings.HasPrefix(res, apiv1.ResourceHugePagesPrefix) {
+		allErrs := field.ErrorList{}
+		for _, msg := range validation.IsQualifiedName(res) {
+			allErrs = append(allErrs, field.Invalid(fldPath, res, msg))
+		}
+		return allErrs
+	}
+	for _, std := range standardResources {
+		if res == string(std) {
+			return nil
+		}
+	}
+	return field.ErrorList{field.NotSupported(fldPath, res, append(standardResources, "<domain>/<name>"))}
+}
+
+// validateRawConfig checks the fields and value types of a decoded config.
+func validateRawConfig(raw interface{}) field.ErrorList {
+	allErrs := field.ErrorList{}
+	ctrs, ok := raw.(map[string]interface{})
+	if !ok {
+		if raw == nil {
+			return allErrs
+		}
+		return append(allErrs, field.TypeInvalid(nil, raw, "must be an object of container names to configs"))
+	}
+	for ctr, ctrcfg := range ctrs {
+		ctrPath := field.NewPath(ctr)
+		if ctrcfg == nil {
+			continue
+		}
+		fields, ok := ctrcfg.(map[string]interface{})
+		if !ok {
+			allErrs = append(allErrs, field.TypeInvalid(ctrPath, ctrcfg, "must be an object"))
+			continue
+		}
+		for name, rescfgs := range fields {
+			switch {
+			case isField(name, []string{"requests", "limits"}):
+				allErrs = append(allErrs, validateRawResources(rescfgs, ctrPath.Child(name))...)
+			case isField(name, []string{"limitRatio", "limitEqualsRequest"}):
+				allErrs = append(allErrs, validateRawLimitModes(name, rescfgs, ctrPath.Child(name))...)
+			case strings.EqualFold(name, "maxAllocatableFraction"):
+				allErrs = append(allErrs, validateRawFractions(rescfgs, ctrPath.Child(name))...)
+			case strings.EqualFold(name, "topology"):
+				allErrs = append(allErrs, validateRawTopology(rescfgs, ctrPath.Child(name))...)
+			case strings.EqualFold(name, "maintenanceWindow"):
+				allErrs = append(allErrs, validateRawMaintenanceWindow(rescfgs, ctrPath.Child(name))...)
+			default:
+				allErrs = append(allErrs, field.NotSupported(ctrPath.Child(name), name, containerFields))
+			}
+		}
+	}
+	return allErrs
+}
+
+func validateRawResources(raw interface{}, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	resources, ok := raw.(map[string]interface{})
+	if !ok {
+		if raw == nil {
+			return allErrs
+		}
+		return append(allErrs, field.TypeInvalid(fldPath, raw, "must be an object of resource names to configs"))
+	}
+	for res, rescfg := range resources {
+		resPath := fldPath.Child(res)
+		if rescfg == nil {
+			continue
+		}
+		fields, ok := rescfg.(map[string]interface{})
+		if !ok {
+			allErrs = append(allErrs, field.TypeInvalid(resPath, rescfg, "must be an object"))
+			continue
+		}
+		for name, value := range fields {
+			fldPath := resPath.Child(name)
+			switch {
+			case isField(name, quantityFields):
+				if !isQuantity(value) {
+					allErrs = append(allErrs, field.Invalid(fldPath, value, "must be a quantity, such as 10m or 1Gi"))
+				}
+			case isField(name, perStepFields):
+				if n, ok := value.(json.Number); !ok || !isInt(n) {
+					allErrs = append(allErrs, field.TypeInvalid(fldPath, value, "must be a whole number"))
+				}
+			case strings.EqualFold(name, "format"):
+				if _, ok := value.(string); !ok {
+					allErrs = append(allErrs, field.TypeInvalid(fldPath, value, "must be a string"))
+				}
+			default:
+				allErrs = append(allErrs, field.NotSupported(fldPath, name, resourceFields))
+			}
+		}
+	}
+	return allErrs
+}
+
+func validateRawTopology(raw interface{}, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	fields, ok := raw.(map[string]interface{})
+	if !ok {
+		if raw == nil {
+			return allErrs
+		}
+		return append(allErrs, field.TypeInvalid(fldPath, raw, "must be an object with a node label key and value"))
+	}
+	for name, value := range fields {
+		if !isField(name, topologyFields) {
+			allErrs = append(allErrs, field.NotSupported(fldPath.Child(name), name, topologyFields))
+			continue
+		}
+		if _, ok := value.(string); !ok {
+			allErrs = append(allErrs, field.TypeInvalid(fldPath.Child(name), value, "must be a string"))
+		}
+	}
+	return allErrs
+}
+
+func validateRawMaintenanceWindow(raw interface{}, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	fields, ok := raw.(map[string]interface{})
+	if !ok {
+		if raw == nil {
+			return allErrs
+		}
+		return append(allErrs, field.TypeInvalid(fldPath, raw, "must be an object with a schedule and duration"))
+	}
+	for name, value := range fields {
+		fldPath := fldPath.Child(name)
+		switch {
+		case strings.EqualFold(name, "allowScaleUp"):
+			if _, ok := value.(bool); !ok {
+				allErrs = append(allErrs, field.TypeInvalid(fldPath, value, "must be true or false"))
+			}
+		case strings.EqualFold(name, "duration"):
+			if s, ok := value.(string); !ok {
+				allErrs = append(allErrs, field.TypeInvalid(fldPath, value, "must be a string"))
+			} else if _, err := time.ParseDuration(s); err != nil {
+				allErrs = append(allErrs, field.Invalid(fldPath, value, "must be a duration, such as 2h or 90m"))
+			}
+		case isField(name, windowFields):
+			if _, ok := value.(string); !ok {
+				allErrs = append(allErrs, field.TypeInvalid(fldPath, value, "must be a string"))
+			}
+		default:
+			allErrs = append(allErrs, field.NotSupported(fldPath, name, windowFields))
+		}
+	}
+	return allErrs
+}
+
+func validateRawLimitModes(name string, raw interface{}, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	modes, ok := raw.(map[string]interface{})
+	if !ok {
+		if raw == nil {
+			return allErrs
+		}
+		return append(allErrs, field.TypeInvalid(fldPath, raw, "must be an object of resource names to values"))
+	}
+	for res, value := range modes {
+		if value == nil {
+			continue
+		}
+		if !strings.EqualFold(name, "limitEqualsRequest") {
+			if _, ok := value.(json.Number); !ok {
+				allErrs = append(allErrs, field.TypeInvalid(fldPath.Child(res), value, "must be a number, such as 2 or 1.5"))
+			}
+		} else if _, ok := value.(bool); !ok {
+			allErrs = append(allErrs, field.TypeInvalid(fldPath.Child(res), value, "must be true or false"))
+		}
+	}
+	return allErrs
+}
+
+func validateRawFractions(raw interface{}, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	fractions, ok := raw.(map[string]interface{})
+	if !ok {
+		if raw == nil {
+			return allErrs
+		}
+		return append(allErrs, field.TypeInvalid(fldPath, raw, "must be an object of resource names to fractions"))
+	}
+	for res, value := range fractions {
+		if value == nil {
+			continue
+		}
+		if _, ok := value.(json.Number); !ok {
+			allErrs = append(allErrs, field.TypeInvalid(fldPath.Child(res), value, "must be a number, such as 0.1"))
+		}
+	}
+	return allErrs
+}
+
+func isField(name string, fields []string) bool {
+	for _, f := range fields {
+		if strings.EqualFold(name, f) {
+			return true
+		}
+	}
+	return false
+}
+
+func isQuantity(value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		_, err := resource.ParseQuantity(v)
+		return err == nil
+	case json.Number:
+		_, err := resource.ParseQuantity(v.String())
+		return err == nil
+	}
+	return false
+}
+
+func isInt(n json.Number) bool {
+	_, err := strconv.Atoi(n.String())
+	return err == nil
+}
@@ -0,0 +1,479 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestParseScaleConfig(t *testing.T) {
+	jsonConfig := `{"fake-agent":{"requests":{"cpu":{"base":"10m","step":"1m","coresPerStep":1},"memory":{"base":"8Mi","max":"1Gi","step":1048576,"nodesPerStep":2}}}}`
+	expected := ScaleConfig{}
+	if err := ParseScaleConfig([]byte(jsonConfig), &expected); err != nil {
+		t.Fatalf("failed to parse JSON config: %v", err)
+	}
+	if len(expected["fake-agent"].Requests) != 2 {
+		t.Fatalf("expected 2 resources, got %v", expected)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		config string
+		expErr bool
+	}{
+		{
+			"block style",
+			`
+fake-agent:
+  requests:
+    cpu:
+      base: 10m
+      step: 1m
+      coresPerStep: 1
+    memory:
+      base: 8Mi
+      max: 1Gi
+      step: 1Mi
+      nodesPerStep: 2
+`,
+			false,
+		},
+		{
+			"quoted quantities and mixed case keys",
+			`
+fake-agent:
+  Requests:
+    cpu: {base: "10m", step: "1m", CoresPerStep: 1}
+    memory: {base: "8Mi", max: "1Gi", step: 1048576, nodesperstep: 2}
+`,
+			false,
+		},
+		{
+			"bad indentation",
+			"fake-agent:\n  requests:\n cpu: {}\n",
+			true,
+		},
+		{
+			"bad quantity",
+			"fake-agent:\n  requests:\n    cpu: {base: ten}\n",
+			true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := ScaleConfig{}
+			err := ParseScaleConfig([]byte(tt.config), &cfg)
+			if tt.expErr {
+				if err == nil {
+					t.Errorf("expected an error, got %v", cfg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !apiequality.Semantic.DeepEqual(cfg, expected) {
+				t.Errorf("expected %v, got %v", expected, cfg)
+			}
+		})
+	}
+}
+
+func TestParseScaleConfigValidation(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		config  string
+		expErrs []string
+	}{
+		{
+			"valid",
+			`{"coredns":{"requests":{"cpu":{"base":"10m","max":"1","step":"1m","coresPerStep":1},"example.com/gpu":{"base":1},"hugepages-2Mi":{"base":"2Mi"}},"limits":{"memory":{"base":"8Mi","max":0}}}}`,
+			nil,
+		},
+		{
+			"empty",
+			"",
+			nil,
+		},
+		{
+			"unknown fields",
+			`{"coredns":{"request":{},"requests":{"cpu":{"base":"10m","step":"1m","corePerStep":1}}}}`,
+			[]string{
+				"coredns.request: Unsupported value",
+				"coredns.requests.cpu.corePerStep: Unsupported value",
+				"coredns.requests.cpu.coresPerStep: Required value",
+			},
+		},
+		{
+			"bad types",
+			`{"coredns":{"requests":{"cpu":{"base":"ten","step":true,"coresPerStep":1.5,"memoryPerStep":"lots"},"memory":"8Mi"}},"kube-proxy":[]}`,
+			[]string{
+				"coredns.requests.cpu.base: Invalid value",
+				"coredns.requests.cpu.coresPerStep: Invalid value",
+				"coredns.requests.cpu.memoryPerStep: Invalid value",
+				"coredns.requests.cpu.step: Invalid value",
+				"coredns.requests.memory: Invalid value",
+				"kube-proxy: Invalid value",
+			},
+		},
+		{
+			"negative quantities",
+			`{"coredns":{"requests":{"cpu":{"base":"-10m","step":"-1m","nodesPerStep":-1}}}}`,
+			[]string{
+				"coredns.requests.cpu.base: Invalid value",
+				"coredns.requests.cpu.nodesPerStep: Invalid value",
+				"coredns.requests.cpu.step: Invalid value",
+			},
+		},
+		{
+			"max less than base",
+			`{"coredns":{"limits":{"memory":{"base":"1Gi","max":"512Mi"}}}}`,
+			[]string{
+				"coredns.limits.memory.max: Invalid value",
+			},
+		},
+		{
+			"step without per-step",
+			`{"coredns":{"requests":{"cpu":{"base":"10m","step":"1m","coresPerStep":0}}}}`,
+			[]string{
+				"coredns.requests.cpu.coresPerStep: Required value",
+			},
+		},
+		{
+			"per-step without step",
+			`{"coredns":{"requests":{"cpu":{"base":"10m","step":"0","nodesPerStep":1}}}}`,
+			[]string{
+				"coredns.requests.cpu.step: Required value",
+			},
+		},
+		{
+			"memory per step",
+			`{"agent":{"requests":{"memory":{"base":"100Mi","step":"10Mi","memoryPerStep":"4Gi"}},"limits":{"memory":{"base":"1Gi","step":"10Mi","memoryPerStep":"-4Gi"}}}}`,
+			[]string{
+				"agent.limits.memory.memoryPerStep: Invalid value",
+			},
+		},
+		{
+			"invalid names",
+			`{"CoreDNS":{"requests":{"cpus":{},"example.com/gpu!":{}}}}`,
+			[]string{
+				"CoreDNS.requests.cpus: Unsupported value",
+				"CoreDNS.requests.example.com/gpu!: Invalid value",
+				"CoreDNS: Invalid value",
+			},
+		},
+		{
+			"quantities too large to compute",
+			`{"coredns":{"requests":{"memory":{"base":"1E"}},"limits":{"memory":{"base":"1","max":"10E"}}}}`,
+			[]string{
+				"coredns.limits.memory.max: Invalid value",
+				"coredns.requests.memory.base: Invalid value",
+			},
+		},
+		{
+			"topology",
+			`{"coredns":{"requests":{"cpu":{"base":"10m"}},"topology":{"key":"topology.kubernetes.io/zone","value":"us-east1-b"}}}`,
+			nil,
+		},
+		{
+			"bad topology",
+			`{"coredns":{"topology":{"key":"","value":"not a label"}},"kube-proxy":{"topology":{"key":"zone!","zones":"a"}}}`,
+			[]string{
+				"coredns.topology.key: Required value",
+				"coredns.topology.value: Invalid value",
+				"kube-proxy.topology.key: Invalid value",
+				"kube-proxy.topology.zones: Unsupported value",
+			},
+		},
+		{
+			"maintenance window",
+			`{"coredns":{"requests":{"cpu":{"base":"10m"}},"maintenanceWindow":{"schedule":"0 2 * * 1-5","duration":"2h","timeZone":"Europe/Berlin","allowScaleUp":true}}}`,
+			nil,
+		},
+		{
+			"bad maintenance window",
+			`{"kube-proxy":{"maintenanceWindow":{"duration":"2 hours","allowScaleUp":"yes","days":"weekdays"}}}`,
+			[]string{
+				"kube-proxy.maintenanceWindow.allowScaleUp: Invalid value",
+				"kube-proxy.maintenanceWindow.days: Unsupported value",
+				"kube-proxy.maintenanceWindow.duration: Invalid value",
+			},
+		},
+		{
+			"invalid maintenance window",
+			`{"coredns":{"maintenanceWindow":{"schedule":"0 25 * *","duration":"0s","timeZone":"Mars/Olympus"}},"kube-proxy":{"maintenanceWindow":{"schedule":"0 2 * * 8","duration":"1h"}},"metrics":{"maintenanceWindow":{"duration":"1h"}}}`,
+			[]string{
+				"coredns.maintenanceWindow.duration: Invalid value",
+				"coredns.maintenanceWindow.schedule: Invalid value",
+				"coredns.maintenanceWindow.timeZone: Invalid value",
+				"kube-proxy.maintenanceWindow.schedule: Invalid value",
+				"metrics.maintenanceWindow.schedule: Required value",
+			},
+		},
+		{
+			"bad rounding",
+			`{"coredns":{"requests":{"cpu":{"base":"10m","roundTo":"-50m","format":"binarySI"}}}}`,
+			[]string{
+				"coredns.requests.cpu.format: Unsupported value",
+				"coredns.requests.cpu.roundTo: Invalid value",
+			},
+		},
+		{
+			"bad format type",
+			`{"coredns":{"requests":{"memory":{"base":"8Mi","format":1}}}}`,
+			[]string{
+				"coredns.requests.memory.format: Invalid value",
+			},
+		},
+		{
+			"limit modes",
+			`{"coredns":{"requests":{"cpu":{"base":"100m"},"memory":{"base":"64Mi"}},"limitRatio":{"memory":1.5},"limitEqualsRequest":{"cpu":true}}}`,
+			nil,
+		},
+		{
+			"bad limit mode types",
+			`{"coredns":{"requests":{"cpu":{"base":"100m"}},"limitRatio":{"cpu":"2"},"limitEqualsRequest":{"cpu":"yes"}}}`,
+			[]string{
+				"coredns.limitEqualsRequest.cpu: Invalid value",
+				"coredns.limitRatio.cpu: Invalid value",
+			},
+		},
+		{
+			"conflicting limit modes",
+			`{"coredns":{"requests":{"cpu":{"base":"100m"},"memory":{"base":"64Mi"}},"limits":{"memory":{"base":"1Gi"}},"limitRatio":{"memory":0.5,"storage":2},"limitEqualsRequest":{"cpu":true,"memory":true,"storage":false}}}`,
+			[]string{
+				"coredns.limitEqualsRequest.memory: Forbidden",
+				"coredns.limitEqualsRequest.memory: Forbidden",
+				"coredns.limitRatio.memory: Forbidden",
+				"coredns.limitRatio.memory: Invalid value",
+				"coredns.limitRatio.storage: Invalid value",
+			},
+		},
+		{
+			"max allocatable fraction",
+			`{"coredns":{"requests":{"cpu":{"base":"100m"}},"maxAllocatableFraction":{"cpu":0.5}}}`,
+			nil,
+		},
+		{
+			"bad max allocatable fraction",
+			`{"coredns":{"requests":{"cpu":{"base":"100m"}},"maxAllocatableFraction":{"cpu":1.5,"memory":0.5}}}`,
+			[]string{
+				"coredns.maxAllocatableFraction.cpu: Invalid value",
+				"coredns.maxAllocatableFraction.memory: Invalid value",
+			},
+		},
+		{
+			"bad max allocatable fraction type",
+			`{"coredns":{"requests":{"cpu":{"base":"100m"}},"maxAllocatableFraction":{"cpu":"half"}}}`,
+			[]string{
+				"coredns.maxAllocatableFraction.cpu: Invalid value",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := ScaleConfig{}
+			err := ParseScaleConfig([]byte(tt.config), &cfg)
+			var errs []string
+			if err != nil {
+				agg, ok := err.(utilerrors.Aggregate)
+				if !ok {
+					t.Fatalf("expected field errors, got %v", err)
+				}
+				for _, e := range agg.Errors() {
+					fe := e.(*field.Error)
+					errs = append(errs, fe.Field+": "+fe.Type.String())
+				}
+				sort.Strings(errs)
+				if len(cfg) != 0 {
+					t.Errorf("expected an invalid config to be ignored, got %v", cfg)
+				}
+			}
+			if !reflect.DeepEqual(errs, tt.expErrs) {
+				t.Errorf("expected errors %q, got %q", tt.expErrs, errs)
+			}
+		})
+	}
+}
+
+func TestParseScaleConfigLayers(t *testing.T) {
+	base := `{"coredns":{"requests":{"cpu":{"base":"10m","max":"1"},"memory":{"base":"8Mi"}},"limits":{"memory":{"base":"16Mi"}}},"kube-proxy":{"requests":{"cpu":{"base":"10m"}}}}`
+	for _, tt := range []struct {
+		name     string
+		layer    string
+		expected string
+	}{
+		{
+			"empty layer",
+			"",
+			base,
+		},
+		{
+			"resources are merged into containers",
+			"coredns:\n  requests:\n    example.com/gpu: {base: 1}\n",
+			`{"coredns":{"requests":{"cpu":{"base":"10m","max":"1"},"example.com/gpu":{"base":"1"},"memory":{"base":"8Mi"}},"limits":{"memory":{"base":"16Mi"}}},"kube-proxy":{"requests":{"cpu":{"base":"10m"}}}}`,
+		},
+		{
+			"resources are replaced as a whole",
+			"coredns:\n  requests:\n    cpu: {base: 20m}\n",
+			`{"coredns":{"requests":{"cpu":{"base":"20m"},"memory":{"base":"8Mi"}},"limits":{"memory":{"base":"16Mi"}}},"kube-proxy":{"requests":{"cpu":{"base":"10m"}}}}`,
+		},
+		{
+			"null removes a resource",
+			"coredns:\n  requests:\n    memory: null\n",
+			`{"coredns":{"requests":{"cpu":{"base":"10m","max":"1"}},"limits":{"memory":{"base":"16Mi"}}},"kube-proxy":{"requests":{"cpu":{"base":"10m"}}}}`,
+		},
+		{
+			"null removes all limits",
+			"coredns:\n  limits: null\n",
+			`{"coredns":{"requests":{"cpu":{"base":"10m","max":"1"},"memory":{"base":"8Mi"}}},"kube-proxy":{"requests":{"cpu":{"base":"10m"}}}}`,
+		},
+		{
+			"null removes a container",
+			`{"kube-proxy":null,"metrics-server":{"requests":{"cpu":{"base":"5m"}}}}`,
+			`{"coredns":{"requests":{"cpu":{"base":"10m","max":"1"},"memory":{"base":"8Mi"}},"limits":{"memory":{"base":"16Mi"}}},"metrics-server":{"requests":{"cpu":{"base":"5m"}}}}`,
+		},
+		{
+			"limit modes are merged into containers",
+			"coredns:\n  limits: null\n  limitRatio: {memory: 2}\n",
+			`{"coredns":{"requests":{"cpu":{"base":"10m","max":"1"},"memory":{"base":"8Mi"}},"limitRatio":{"memory":2}},"kube-proxy":{"requests":{"cpu":{"base":"10m"}}}}`,
+		},
+		{
+			"max allocatable fractions are merged into containers",
+			"coredns:\n  maxAllocatableFraction: {cpu: 0.5, memory: 0.25}\n",
+			`{"coredns":{"requests":{"cpu":{"base":"10m","max":"1"},"memory":{"base":"8Mi"}},"limits":{"memory":{"base":"16Mi"}},"maxAllocatableFraction":{"cpu":0.5,"memory":0.25}},"kube-proxy":{"requests":{"cpu":{"base":"10m"}}}}`,
+		},
+		{
+			"limit modes conflict with lower layers",
+			"coredns:\n  limitRatio: {memory: 2}\n",
+			base,
+		},
+		{
+			"the merged config is validated",
+			"coredns:\n  requests:\n    cpu: {base: 2}\n  limits:\n    memory: {base: 32Mi, max: 16Mi}\n",
+			base,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := ScaleConfig{}
+			if err := ParseScaleConfig([]byte(base), &cfg); err != nil {
+				t.Fatalf("failed to parse base config: %v", err)
+			}
+			if err := ParseScaleConfig([]byte(tt.layer), &cfg); err != nil {
+				t.Logf("layer rejected: %v", err)
+			}
+			got, err := json.Marshal(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	good := writeFile("good.yaml", "kube-proxy:\n  requests:\n    cpu: {base: 20m}\n")
+	bad := writeFile("bad.yaml", "kube-proxy:\n  requests:\n    cpu: {base: -20m}\n")
+	defaultConfig := `{"coredns":{"requests":{"cpu":{"base":"10m"}}},"kube-proxy":{"requests":{"cpu":{"base":"10m"}}}}`
+
+	cfg, err := LoadConfig(defaultConfig, good)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg) != 2 {
+		t.Errorf("expected the default and file configs to be merged, got %v", cfg)
+	}
+	if base := cfg["kube-proxy"].Requests["cpu"].Base; base.String() != "20m" {
+		t.Errorf("expected the config file to override the default config, got %v", base)
+	}
+
+	overlay := writeFile("overlay.yaml", "coredns: null\n")
+	cfg, err = LoadConfig(defaultConfig, good, overlay)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, found := cfg["coredns"]; found || len(cfg) != 1 {
+		t.Errorf("expected the overlay to remove coredns, got %v", cfg)
+	}
+
+	for _, tt := range []struct {
+		name          string
+		defaultConfig string
+		configFile    string
+	}{
+		{"bad default config", `{"coredns":{"requests":{"cpus":{}}}}`, good},
+		{"bad config file", defaultConfig, bad},
+		{"missing config file", defaultConfig, filepath.Join(dir, "missing.yaml")},
+	} {
+		if cfg, err := LoadConfig(tt.defaultConfig, tt.configFile); err == nil {
+			t.Errorf("%s: expected an error, got %v", tt.name, cfg)
+		}
+	}
+}
+
+func TestExpandConfigPaths(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.yaml", "a.json", "c.yml", "README.md", ".hidden.yaml", "sub/d.yaml"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The keys of a mounted ConfigMap are symlinks.
+	if err := os.Symlink(filepath.Join(dir, "b.yaml"), filepath.Join(dir, "linked.yaml")); err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := ExpandConfigPaths([]string{filepath.Join(dir, "sub", "d.yaml"), dir})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{
+		filepath.Join(dir, "sub", "d.yaml"),
+		filepath.Join(dir, "a.json"),
+		filepath.Join(dir, "b.yaml"),
+		filepath.Join(dir, "c.yml"),
+		filepath.Join(dir, "linked.yaml"),
+	}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected %v, got %v", expected, paths)
+	}
+
+	if paths, err := ExpandConfigPaths([]string{filepath.Join(dir, "missing.yaml")}); err == nil {
+		t.Errorf("expected an error for a missing file, got %v", paths)
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// FileConfig is a default config with config files merged over it in turn,
+// for callers which read it far more often than it changes.  The files are
+// only re-read once they are seen to change, and a config which fails to load
+// leaves the last good one in use.  It is safe for concurrent use.
+type FileConfig struct {
+	defaultConfig ScaleConfig
+	paths         []string
+	// If the files can't be watched, each read checks whether they changed.
+	watcher *fileWatcher
+
+	lock    sync.Mutex
+	files   []*fileLayer
+	current ScaleConfig
+	// Set while the files on disk don't load, so they are retried.
+	failed bool
+}
+
+// NewFileConfig loads a config from a default config and config files or
+// directories of them, which are watched until stopCh is closed.  It fails if
+// the config does not load.
+func NewFileConfig(defaultConfig string, paths []string, stopCh <-chan struct{}) (*FileConfig, error) {
+	cfg := ScaleConfig{}
+	if defaultConfig != "" {
+		if err := ParseScaleConfig([]byte(defaultConfig), &cfg); err != nil {
+			return nil, fmt.Errorf("invalid default config: %v", err)
+		}
+	}
+	c := &FileConfig{defaultConfig: cfg, paths: paths}
+	if len(paths) > 0 {
+		var err error
+		if c.watcher, err = newFileWatcher(paths, stopCh); err != nil {
+			glog.Warningf("Failed to watch config files, they will be checked on each read: %v", err)
+		}
+	}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Get returns the current config, first re-reading the files if they may
+// have changed.
+func (c *FileConfig) Get() ScaleConfig {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.watcher != nil && !c.failed {
+		select {
+		case <-c.watcher.Changed():
+		default:
+			return c.current
+		}
+	}
+	if err := c.reload(); err != nil {
+		glog.Errorf("Keeping the last good config: %v", err)
+	}
+	return c.current
+}
+
+// reload re-reads the files which changed, and rebuilds the config if any
+// did.
+func (c *FileConfig) reload() error {
+	files, changed, err := readConfigFiles(c.paths, c.files)
+	if err == nil {
+		c.files = files
+		if changed || c.failed || c.current == nil {
+			err = c.parse()
+		}
+	}
+	c.failed = err != nil
+	return err
+}
+
+func (c *FileConfig) parse() error {
+	cfg := c.defaultConfig.DeepCopy()
+	for _, f := range c.files {
+		if err := ParseScaleConfig(f.data, &cfg); err != nil {
+			return fmt.Errorf("failed to parse %s: %v", f, err)
+		}
+	}
+	c.current = cfg
+	glog.V(0).Infof("Loaded config from %d config files", len(c.files))
+	return nil
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestFileConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(base string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte("thing: {requests: {cpu: {base: "+base+"}}}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("10m")
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	c, err := NewFileConfig(`{"other":{"requests":{"cpu":{"base":"1"}}}}`, []string{path}, stopCh)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	base := func() string {
+		cfg := c.Get()
+		if _, found := cfg["other"]; !found {
+			t.Errorf("expected the default config to be kept, got %v", cfg)
+		}
+		return cfg["thing"].Requests["cpu"].Base.String()
+	}
+	expectBase := func(exp string) {
+		t.Helper()
+		deadline := time.Now().Add(wait.ForeverTestTimeout)
+		for got := base(); got != exp; got = base() {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected base %s, got %s", exp, got)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	expectBase("10m")
+
+	write("20m")
+	expectBase("20m")
+
+	// A config which fails to parse keeps the last good one, and is retried
+	// until it is fixed.
+	write("x")
+	if got := base(); got != "20m" {
+		t.Errorf("expected the last good base 20m, got %s", got)
+	}
+	write("30m")
+	expectBase("30m")
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/golang/glog"
+)
+
+// fileWatcher signals when config files change, so they are re-read without
+// waiting for the next poll.  It watches the directory holding each file
+// rather than the file itself, because a mounted ConfigMap is updated by
+// swapping a symlink in that directory, and editors often replace files.
+type fileWatcher struct {
+	watcher *fsnotify.Watcher
+	// Config files, and directories all of whose files are config files.
+	files     map[string]bool
+	dirs      map[string]bool
+	changedCh chan struct{}
+}
+
+// newFileWatcher starts watching config paths, each of which is a file or a
+// directory of files.
+func newFileWatcher(paths []string, stopCh <-chan struct{}) (*fileWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &fileWatcher{
+		watcher:   watcher,
+		files:     map[string]bool{},
+		dirs:      map[string]bool{},
+		changedCh: make(chan struct{}, 1),
+	}
+	watched := map[string]bool{}
+	for _, path := range paths {
+		path = filepath.Clean(path)
+		dir := filepath.Dir(path)
+		if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+			w.dirs[path] = true
+			dir = path
+		} else {
+			w.files[path] = true
+		}
+		if watched[dir] {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+		watched[dir] = true
+		glog.V(4).Infof("Watching %s for config changes", dir)
+	}
+
+	go w.run(stopCh)
+	return w, nil
+}
+
+func (w *fileWatcher) run(stopCh <-chan struct{}) {
+	defer w.watcher.Close()
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if w.isConfigEvent(event) {
+				glog.V(4).Infof("Config changed: %s", event)
+				w.notify()
+			}
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			glog.Warningf("Error watching config files: %v", err)
+			// Events may have been lost.
+			w.notify()
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// isConfigEvent returns whether an event may change a config file.  Names
+// starting with ".." are the bookkeeping of a mounted ConfigMap, through which
+// its files are linked.
+func (w *fileWatcher) isConfigEvent(event fsnotify.Event) bool {
+	if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+		return false
+	}
+	dir, name := filepath.Split(event.Name)
+	return w.files[event.Name] || w.dirs[filepath.Clean(dir)] || strings.HasPrefix(name, "..")
+}
+
+// notify signals a change, without blocking if one is already pending.
+func (w *fileWatcher) notify() {
+	select {
+	case w.changedCh <- struct{}{}:
+	default:
+	}
+}
+
+// Changed receives whenever a config file may have changed.
+func (w *fileWatcher) Changed() <-chan struct{} {
+	return w.changedCh
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestFileWatcher(t *testing.T) {
+	dir := t.TempDir()
+	mustDo := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Lay out a mounted ConfigMap: each key links through ..data to a
+	// timestamped directory, which is swapped on each update.
+	mustDo(os.Mkdir(filepath.Join(dir, "..v1"), 0755))
+	mustDo(os.WriteFile(filepath.Join(dir, "..v1", "config.yaml"), []byte("a: {}"), 0644))
+	mustDo(os.Symlink("..v1", filepath.Join(dir, "..data")))
+	mustDo(os.Symlink(filepath.Join("..data", "config.yaml"), filepath.Join(dir, "config.yaml")))
+	other := filepath.Join(t.TempDir(), "other.yaml")
+	mustDo(os.WriteFile(other, []byte("a: {}"), 0644))
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	w, err := newFileWatcher([]string{filepath.Join(dir, "config.yaml"), other}, stopCh)
+	if err != nil {
+		t.Fatalf("failed to watch: %v", err)
+	}
+	expectChange := func(what string) {
+		t.Helper()
+		select {
+		case <-w.Changed():
+		case <-time.After(wait.ForeverTestTimeout):
+			t.Fatalf("timed out waiting for %s to be noticed", what)
+		}
+	}
+	// Wait for a burst of events to end, so that a later change is not
+	// noticed through one of them.
+	drain := func() {
+		t.Helper()
+		timeout := time.After(wait.ForeverTestTimeout)
+		for {
+			select {
+			case <-w.Changed():
+			case <-time.After(100 * time.Millisecond):
+				return
+			case <-timeout:
+				t.Fatal("timed out waiting for config events to stop")
+			}
+		}
+	}
+
+	mustDo(os.Mkdir(filepath.Join(dir, "..v2"), 0755))
+	mustDo(os.WriteFile(filepath.Join(dir, "..v2", "config.yaml"), []byte("b: {}"), 0644))
+	mustDo(os.Symlink("..v2", filepath.Join(dir, "..data_tmp")))
+	mustDo(os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+	expectChange("a ConfigMap update")
+	drain()
+
+	mustDo(os.WriteFile(other, []byte("b: {}"), 0644))
+	expectChange("a write")
+
+	// Which events are ignored is checked directly, since their absence can
+	// only be seen by waiting.
+	for _, tc := range []struct {
+		what  string
+		event fsnotify.Event
+	}{
+		{"an unrelated file", fsnotify.Event{Name: filepath.Join(dir, "unrelated.txt"), Op: fsnotify.Create}},
+		{"a chmod", fsnotify.Event{Name: other, Op: fsnotify.Chmod}},
+	} {
+		if w.isConfigEvent(tc.event) {
+			t.Errorf("expected %s to be ignored", tc.what)
+		}
+	}
+}
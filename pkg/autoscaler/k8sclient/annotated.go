@@ -0,0 +1,98 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/metadata/metadatainformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ConfigAnnotation holds the scaling config of an object, when targets are
+// chosen by annotation rather than by flags.
+const ConfigAnnotation = "cpvpa.k8s.io/config"
+
+// annotatedKind watches the metadata of every object of one kind, in all
+// namespaces.
+type annotatedKind struct {
+	spec     *targetSpec
+	informer cache.SharedIndexInformer
+}
+
+// watchAnnotatedKinds starts watching every supported kind, and waits for the
+// initial list of each to complete.
+func watchAnnotatedKinds(client kubernetes.Interface, metadataClient metadata.Interface, stopCh <-chan struct{}) ([]*annotatedKind, error) {
+	specs, err := discoverAllKinds(client)
+	if err != nil {
+		return nil, err
+	}
+
+	factory := metadatainformer.NewSharedInformerFactory(metadataClient, 0)
+	kinds := []*annotatedKind{}
+	for _, spec := range specs {
+		gvr, err := spec.GroupVersionResource()
+		if err != nil {
+			return nil, err
+		}
+		kinds = append(kinds, &annotatedKind{
+			spec:     spec,
+			informer: factory.ForResource(gvr).Informer(),
+		})
+		glog.V(4).Infof("Watching %s in %v for the %s annotation", spec.Kind, spec.GroupVersion, ConfigAnnotation)
+	}
+
+	factory.Start(stopCh)
+	for gvr, synced := range factory.WaitForCacheSync(stopCh) {
+		if !synced {
+			return nil, fmt.Errorf("failed to sync %v", gvr)
+		}
+	}
+	return kinds, nil
+}
+
+func (k *k8sClient) GetTargetConfigs() (map[Target]string, error) {
+	if k.annotated == nil {
+		return nil, fmt.Errorf("targets are not chosen by the %s annotation", ConfigAnnotation)
+	}
+
+	configs := map[Target]string{}
+	for _, ak := range k.annotated {
+		for _, obj := range ak.informer.GetStore().List() {
+			meta, ok := obj.(*metav1.PartialObjectMetadata)
+			if !ok {
+				continue
+			}
+			config, found := meta.Annotations[ConfigAnnotation]
+			if !found {
+				continue
+			}
+			// Deployments copy their annotations to the ReplicaSets they
+			// own, and those must be left to their controller.
+			if metav1.GetControllerOfNoCopy(meta) != nil {
+				continue
+			}
+			tgt := Target{Kind: ak.spec.Kind, Namespace: meta.Namespace, Name: meta.Name, UID: meta.UID}
+			configs[tgt] = config
+		}
+	}
+	return configs, nil
+}
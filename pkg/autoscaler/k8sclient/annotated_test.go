@@ -0,0 +1,88 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	"k8s.io/client-go/metadata/metadatainformer"
+	"k8s.io/utils/ptr"
+)
+
+func TestGetTargetConfigs(t *testing.T) {
+	object := func(kind, name string, annotations map[string]string, owners ...metav1.OwnerReference) runtime.Object {
+		return &metav1.PartialObjectMetadata{
+			TypeMeta: metav1.TypeMeta{APIVersion: "apps/v1", Kind: kind},
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:       "default",
+				Name:            name,
+				UID:             types.UID("uid-" + name),
+				Annotations:     annotations,
+				OwnerReferences: owners,
+			},
+		}
+	}
+	scheme := metadatafake.NewTestScheme()
+	if err := metav1.AddMetaToScheme(scheme); err != nil {
+		t.Fatalf("failed to build scheme: %v", err)
+	}
+	client := metadatafake.NewSimpleMetadataClient(scheme,
+		object("Deployment", "thing", map[string]string{ConfigAnnotation: `{"thing":{}}`}),
+		object("Deployment", "plain", nil),
+		object("ReplicaSet", "thing-1234", map[string]string{ConfigAnnotation: `{"thing":{}}`},
+			metav1.OwnerReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "thing", Controller: ptr.To(true)}),
+		object("DaemonSet", "agent", map[string]string{ConfigAnnotation: `not json`}),
+	)
+
+	factory := metadatainformer.NewSharedInformerFactory(client, 0)
+	k8scli := &k8sClient{}
+	for _, kind := range []string{"Deployment", "DaemonSet", "ReplicaSet"} {
+		spec, err := newTargetSpec(kind, map[string]bool{"apps/v1": true}, "", "")
+		if err != nil {
+			t.Fatalf("error making target spec: %v", err)
+		}
+		gvr, err := spec.GroupVersionResource()
+		if err != nil {
+			t.Fatalf("error making resource: %v", err)
+		}
+		k8scli.annotated = append(k8scli.annotated, &annotatedKind{
+			spec:     spec,
+			informer: factory.ForResource(gvr).Informer(),
+		})
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	factory.Start(stopCh)
+	factory.WaitForCacheSync(stopCh)
+
+	configs, err := k8scli.GetTargetConfigs()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expConfigs := map[Target]string{
+		{Kind: "Deployment", Namespace: "default", Name: "thing", UID: "uid-thing"}: `{"thing":{}}`,
+		{Kind: "DaemonSet", Namespace: "default", Name: "agent", UID: "uid-agent"}:  `not json`,
+	}
+	if !reflect.DeepEqual(configs, expConfigs) {
+		t.Errorf("expected configs %v, got %v", expConfigs, configs)
+	}
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ConfigMapWatcher watches one key of a ConfigMap through the API, rather than
+// waiting for the kubelet to sync a mounted volume.
+type ConfigMapWatcher struct {
+	Namespace string
+	Name      string
+	Key       string
+	informer  cache.SharedIndexInformer
+	changedCh chan struct{}
+}
+
+// NewConfigMapWatcher starts watching a ConfigMap, and waits for the initial
+// list to complete.  The ConfigMap does not need to exist.
+func NewConfigMapWatcher(client kubernetes.Interface, namespace, name, key string, stopCh <-chan struct{}) (*ConfigMapWatcher, error) {
+	factory := informers.NewSharedInformerFactoryWithOptions(client, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		}))
+	w := &ConfigMapWatcher{
+		Namespace: namespace,
+		Name:      name,
+		Key:       key,
+		informer:  factory.Core().V1().ConfigMaps().Informer(),
+		changedCh: make(chan struct{}, 1),
+	}
+	_, err := w.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { w.notify() },
+		UpdateFunc: func(interface{}, interface{}) { w.notify() },
+		DeleteFunc: func(interface{}) { w.notify() },
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	factory.Start(stopCh)
+	if !cache.WaitForCacheSync(stopCh, w.informer.HasSynced) {
+		return nil, fmt.Errorf("failed to sync ConfigMap %s", w)
+	}
+	glog.V(4).Infof("Watching ConfigMap %s", w)
+	return w, nil
+}
+
+func (w *ConfigMapWatcher) String() string {
+	return fmt.Sprintf("%s/%s:%s", w.Namespace, w.Name, w.Key)
+}
+
+// notify signals a change, without blocking if one is already pending.
+func (w *ConfigMapWatcher) notify() {
+	select {
+	case w.changedCh <- struct{}{}:
+	default:
+	}
+}
+
+// Changed receives whenever the ConfigMap is created, updated or deleted.
+func (w *ConfigMapWatcher) Changed() <-chan struct{} {
+	return w.changedCh
+}
+
+// Get returns the value of the key, and whether the ConfigMap and key exist.
+func (w *ConfigMapWatcher) Get() (string, bool) {
+	obj, exists, err := w.informer.GetStore().GetByKey(w.Namespace + "/" + w.Name)
+	if err != nil || !exists {
+		return "", false
+	}
+	cm, ok := obj.(*apiv1.ConfigMap)
+	if !ok {
+		return "", false
+	}
+	value, found := cm.Data[w.Key]
+	return value, found
+}
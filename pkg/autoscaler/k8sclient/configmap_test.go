@@ -0,0 +1,68 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestConfigMapWatcher(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	w, err := NewConfigMapWatcher(client, "kube-system", "thing-config", "config.json", stopCh)
+	if err != nil {
+		t.Fatalf("failed to watch ConfigMap: %v", err)
+	}
+	if _, found := w.Get(); found {
+		t.Errorf("expected no value before the ConfigMap exists")
+	}
+
+	expectValue := func(action, expValue string, expFound bool) {
+		select {
+		case <-w.Changed():
+		case <-time.After(wait.ForeverTestTimeout):
+			t.Fatalf("timed out waiting for the ConfigMap to be %s", action)
+		}
+		value, found := w.Get()
+		if value != expValue || found != expFound {
+			t.Errorf("after the ConfigMap was %s, expected (%q, %t), got (%q, %t)", action, expValue, expFound, value, found)
+		}
+	}
+
+	cm := &apiv1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "thing-config"},
+		Data:       map[string]string{"config.json": "{}"},
+	}
+	if _, err := client.CoreV1().ConfigMaps("kube-system").Create(context.TODO(), cm, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("failed to create ConfigMap: %v", err)
+	}
+	expectValue("created", "{}", true)
+
+	cm.Data = map[string]string{"other.json": "{}"}
+	if _, err := client.CoreV1().ConfigMaps("kube-system").Update(context.TODO(), cm, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("failed to update ConfigMap: %v", err)
+	}
+	expectValue("updated", "", false)
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// LastUpdatedAnnotation records when cpvpa last set the resources of a
+// target, so that its update cooldown outlives a restart.
+const LastUpdatedAnnotation = "cpvpa.k8s.io/last-updated"
+
+// GetLastUpdated returns the time in the LastUpdatedAnnotation of the target,
+// or the zero time if it has none.
+func (k *k8sClient) GetLastUpdated(target Target) (time.Time, error) {
+	obj, err := k.getTarget(target)
+	if err != nil {
+		return time.Time{}, err
+	}
+	value, found := obj.GetAnnotations()[LastUpdatedAnnotation]
+	if !found {
+		return time.Time{}, nil
+	}
+	last, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		glog.Warningf("Ignoring invalid %s annotation of %s: %v", LastUpdatedAnnotation, target, err)
+		return time.Time{}, nil
+	}
+	return last, nil
+}
+
+// stampLastUpdated adds the LastUpdatedAnnotation to the metadata of a
+// patch, if updates are recorded.
+func (k *k8sClient) stampLastUpdated(metadata map[string]interface{}) {
+	if !k.recordLastUpdated {
+		return
+	}
+	annotations, _ := metadata["annotations"].(map[string]interface{})
+	if annotations == nil {
+		annotations = map[string]interface{}{}
+		metadata["annotations"] = annotations
+	}
+	annotations[LastUpdatedAnnotation] = time.Now().UTC().Format(time.RFC3339)
+}
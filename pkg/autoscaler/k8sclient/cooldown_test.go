@@ -0,0 +1,116 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGetLastUpdated(t *testing.T) {
+	spec, err := newTargetSpec("Deployment", map[string]bool{"apps/v1": true}, "default", "thing")
+	if err != nil {
+		t.Fatalf("error making target: %v", err)
+	}
+	for _, tc := range []struct {
+		name       string
+		annotation string
+		expected   time.Time
+	}{
+		{"none", "", time.Time{}},
+		{"recorded", "2024-03-05T02:00:00Z", time.Date(2024, 3, 5, 2, 0, 0, 0, time.UTC)},
+		{"invalid", "yesterday", time.Time{}},
+	} {
+		deployment := &appsv1.Deployment{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "thing"},
+		}
+		if tc.annotation != "" {
+			deployment.Annotations = map[string]string{LastUpdatedAnnotation: tc.annotation}
+		}
+		obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(deployment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		k8scli := &k8sClient{
+			target:        spec,
+			dynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), &unstructured.Unstructured{Object: obj}),
+		}
+		last, err := k8scli.GetLastUpdated(Target{Kind: "Deployment", Namespace: "default", Name: "thing"})
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		} else if !last.Equal(tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, last)
+		}
+	}
+}
+
+func TestUpdatesRecordLastUpdated(t *testing.T) {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "thing"},
+		Spec: appsv1.DeploymentSpec{
+			Template: apiv1.PodTemplateSpec{
+				Spec: apiv1.PodSpec{
+					Containers: []apiv1.Container{{Name: "thing"}},
+				},
+			},
+		},
+	}
+	spec, err := newTargetSpec("Deployment", map[string]bool{"apps/v1": true}, "default", "thing")
+	if err != nil {
+		t.Fatalf("error making target: %v", err)
+	}
+	target := Target{Kind: "Deployment", Namespace: "default", Name: "thing"}
+	resources := map[string]apiv1.ResourceRequirements{
+		"thing": {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("100m")}},
+	}
+	for _, tc := range []struct {
+		name   string
+		update func(k *k8sClient) error
+	}{
+		{"update", func(k *k8sClient) error { return k.UpdateResources(target, resources) }},
+		{"revert", func(k *k8sClient) error { return k.RevertResources(target, resources) }},
+	} {
+		client := fake.NewSimpleClientset(deployment.DeepCopy())
+		k8scli := &k8sClient{target: spec, clientset: client, recordLastUpdated: true}
+		before := time.Now().Truncate(time.Second)
+		if err := tc.update(k8scli); err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		updated, err := client.AppsV1().Deployments("default").Get(context.TODO(), "thing", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		last, err := time.Parse(time.RFC3339, updated.Annotations[LastUpdatedAnnotation])
+		if err != nil {
+			t.Errorf("%s: expected a %s annotation, got %v", tc.name, LastUpdatedAnnotation, err)
+		} else if last.Before(before) || last.After(time.Now()) {
+			t.Errorf("%s: expected the %s annotation to be the time of the update, got %v", tc.name, LastUpdatedAnnotation, last)
+		}
+	}
+}
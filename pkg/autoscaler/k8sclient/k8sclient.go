@@ -23,6 +23,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/version"
 
@@ -30,31 +31,90 @@ import (
 	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/metadata"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
 )
 
 // K8sClient - Wraps all needed client functionalities for autoscaler
 type K8sClient interface {
 	// GetClusterSize counts schedulable nodes and cores in the cluster
 	GetClusterSize() (*ClusterSize, error)
+	// GetTargets lists the objects whose resources should be scaled
+	GetTargets() ([]Target, error)
+	// GetTargetConfigs lists the objects which carry the ConfigAnnotation,
+	// along with the value of the annotation
+	GetTargetConfigs() (map[Target]string, error)
+	// GetResources returns the current resources of each container in the
+	// target
+	GetResources(target Target) (map[string]apiv1.ResourceRequirements, error)
 	// UpdateResources updates the resource needs for the containers in the target
-	UpdateResources(resources map[string]apiv1.ResourceRequirements) error
+	UpdateResources(target Target, resources map[string]apiv1.ResourceRequirements) error
+	// GetUnconfiguredResources returns the resources of the containers in
+	// the target which UpdateResources would remove
+	GetUnconfiguredResources(target Target, resources map[string]apiv1.ResourceRequirements) (map[string]apiv1.ResourceRequirements, error)
+	// RevertResources sets the resources of the containers in the target to
+	// exactly those given
+	RevertResources(target Target, resources map[string]apiv1.ResourceRequirements) error
+	// GetLastUpdated returns when the resources of the target were last set,
+	// or the zero time if that was not recorded
+	GetLastUpdated(target Target) (time.Time, error)
+	// GetRolloutStatus returns whether the latest change to the target has
+	// rolled out
+	GetRolloutStatus(target Target) (*RolloutStatus, error)
+	// GetResourcePolicy returns the LimitRanges and ResourceQuotas which the
+	// resources of the target must comply with
+	GetResourcePolicy(target Target) (*ResourcePolicy, error)
+	// RecordEvent records an event on the target
+	RecordEvent(target Target, eventType, reason, message string)
+}
+
+// Target identifies a single object whose resources are scaled.  UID is only
+// known for targets which were listed, so a re-created object is a new target.
+type Target struct {
+	Kind      string
+	Namespace string
+	Name      string
+	UID       types.UID
+}
+
+func (t Target) String() string {
+	return fmt.Sprintf("%s/%s/%s", strings.ToLower(t.Kind), t.Namespace, t.Name)
 }
 
 // k8sClient - Wraps all Kubernetes API client functionality.
 type k8sClient struct {
 	target        *targetSpec
+	selector      labels.Selector
+	kinds         []*targetSpec
+	annotated     []*annotatedKind
 	clientset     kubernetes.Interface
+	dynamicClient dynamic.Interface
+	recorder      record.EventRecorder
 	clusterStatus *ClusterSize
 	dryRun        bool
+	// Set to remove the resources which cpvpa set, but are no longer in the
+	// config.
+	removeUnconfigured bool
+	// Set to record the time of each update in the LastUpdatedAnnotation.
+	recordLastUpdated bool
 }
 
-// NewK8sClient gives a k8sClient with the given dependencies.
-func NewK8sClient(namespace, target, kubeconfig string, dryRun bool) (K8sClient, error) {
+// BuildConfig returns the config to reach the apiserver, either from a
+// kubeconfig file or from the in-cluster environment.
+func BuildConfig(kubeconfig string) (*rest.Config, error) {
 	var config *rest.Config
 	var err error
 	if kubeconfig != "" {
@@ -66,23 +126,90 @@ func NewK8sClient(namespace, target, kubeconfig string, dryRun bool) (K8sClient,
 		return nil, err
 	}
 	config.UserAgent = userAgent()
+	return config, nil
+}
+
+// Options configures a K8sClient.  The targets are chosen by exactly one of
+// Target, TargetSelector, AnnotatedTargets or Controller.
+type Options struct {
+	Kubeconfig string
+	// Namespace is the namespace of the Target or TargetSelector.
+	Namespace string
+	// Target is a single object, in format kind/name.
+	Target string
+	// TargetSelector is every object of a kind which matches a label
+	// selector, in format kind/selector.
+	TargetSelector string
+	// AllNamespaces matches the TargetSelector in all namespaces.
+	AllNamespaces bool
+	// AnnotatedTargets is every object which carries the ConfigAnnotation.
+	AnnotatedTargets bool
+	// Controller lets the caller choose targets of any kind.
+	Controller bool
+	DryRun     bool
+	// RemoveUnconfigured removes the resources which cpvpa set, but are no
+	// longer in the config.
+	RemoveUnconfigured bool
+	// RecordLastUpdated records the time of each update of a target in its
+	// LastUpdatedAnnotation.
+	RecordLastUpdated bool
+}
+
+// NewK8sClient gives a k8sClient with the given dependencies.
+func NewK8sClient(c Options) (K8sClient, error) {
+	config, err := BuildConfig(c.Kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	// The dynamic client is only used to read objects, so it talks JSON.
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	metadataClient, err := metadata.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
 	// Use protobufs for communication with apiserver.
+	config = rest.CopyConfig(config)
 	config.ContentType = "application/vnd.kubernetes.protobuf"
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		return nil, err
 	}
 
-	tgt, err := makeTarget(clientset, target, namespace)
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartLogging(glog.Infof)
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+
+	k := &k8sClient{
+		clientset:     clientset,
+		dynamicClient: dynamicClient,
+		recorder:      broadcaster.NewRecorder(scheme.Scheme, apiv1.EventSource{Component: "cpvpa"}),
+		dryRun:        c.DryRun,
+
+		removeUnconfigured: c.RemoveUnconfigured,
+		recordLastUpdated:  c.RecordLastUpdated,
+	}
+	switch {
+	case c.Controller:
+		k.kinds, err = discoverAllKinds(clientset)
+	case c.AnnotatedTargets:
+		k.annotated, err = watchAnnotatedKinds(clientset, metadataClient, wait.NeverStop)
+	case c.TargetSelector != "":
+		namespace := c.Namespace
+		if c.AllNamespaces {
+			namespace = ""
+		}
+		k.target, k.selector, err = makeTargetSelector(clientset, c.TargetSelector, namespace)
+	default:
+		k.target, err = makeTarget(clientset, c.Target, c.Namespace)
+	}
 	if err != nil {
 		return nil, err
 	}
-
-	return &k8sClient{
-		clientset: clientset,
-		target:    tgt,
-		dryRun:    dryRun,
-	}, nil
+	return k, nil
 }
 
 func userAgent() string {
@@ -118,20 +245,72 @@ func makeTarget(client kubernetes.Interface, target, namespace string) (*targetS
 	return tgt, nil
 }
 
-func discoverAPI(client kubernetes.Interface, kindArg string) (kind string, groupVersions map[string]bool, err error) {
-	var plural string
+// makeTargetSelector parses a "kind/selector" string.  The returned targetSpec
+// has no name, and is used to list and patch every matching object.
+func makeTargetSelector(client kubernetes.Interface, targetSelector, namespace string) (*targetSpec, labels.Selector, error) {
+	splits := strings.SplitN(targetSelector, "/", 2)
+	if len(splits) != 2 {
+		return nil, nil, fmt.Errorf("target selector format error: %v", targetSelector)
+	}
+	selector, err := labels.Parse(splits[1])
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid label selector %q: %v", splits[1], err)
+	}
+
+	kind, groupVersions, err := discoverAPI(client, splits[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tgt, err := newTargetSpec(kind, groupVersions, namespace, "")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	glog.V(4).Infof("Discovered target selector %s in %v", targetSelector, tgt.GroupVersion)
+	return tgt, selector, nil
+}
+
+// supportedKinds are all of the kinds which can be scaled.
+var supportedKinds = []string{"deployment", "daemonset", "replicaset"}
+
+// discoverAllKinds returns a targetSpec, with no namespace or name, for every
+// supported kind.
+func discoverAllKinds(client kubernetes.Interface) ([]*targetSpec, error) {
+	specs := []*targetSpec{}
+	for _, kindArg := range supportedKinds {
+		kind, groupVersions, err := discoverAPI(client, kindArg)
+		if err != nil {
+			return nil, err
+		}
+		spec, err := newTargetSpec(kind, groupVersions, "", "")
+		if err != nil {
+			return nil, err
+		}
+		glog.V(4).Infof("Discovered kind %s in %v", kind, spec.GroupVersion)
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// kindToResource returns the canonical kind and the plural resource name for
+// a (case-insensitive) target kind.
+func kindToResource(kindArg string) (kind string, plural string, err error) {
 	switch strings.ToLower(kindArg) {
 	case "deployment":
-		kind = "Deployment"
-		plural = "deployments"
+		return "Deployment", "deployments", nil
 	case "daemonset":
-		kind = "DaemonSet"
-		plural = "daemonsets"
+		return "DaemonSet", "daemonsets", nil
 	case "replicaset":
-		kind = "ReplicaSet"
-		plural = "replicasets"
-	default:
-		return "", nil, fmt.Errorf("unknown kind %q", kindArg)
+		return "ReplicaSet", "replicasets", nil
+	}
+	return "", "", fmt.Errorf("unknown kind %q", kindArg)
+}
+
+func discoverAPI(client kubernetes.Interface, kindArg string) (kind string, groupVersions map[string]bool, err error) {
+	kind, plural, err := kindToResource(kindArg)
+	if err != nil {
+		return "", nil, err
 	}
 
 	resourceLists, err := client.Discovery().ServerPreferredNamespacedResources()
@@ -158,10 +337,13 @@ func discoverAPI(client kubernetes.Interface, kindArg string) (kind string, grou
 	return kind, groupVersions, nil
 }
 
-// targetSpec stores the scalable target resource.
+// targetSpec stores the scalable target resource.  Name is empty when the
+// targets are chosen by a label selector, and Namespace is empty when they are
+// chosen from all namespaces.
 type targetSpec struct {
 	Kind         string
 	GroupVersion string
+	Resource     string
 	Namespace    string
 	Name         string
 	patcher      patchFunc
@@ -176,18 +358,31 @@ func newTargetSpec(kind string, groupVersions map[string]bool, namespace, name s
 	if err != nil {
 		return nil, err
 	}
+	_, plural, err := kindToResource(kind)
+	if err != nil {
+		return nil, err
+	}
 
 	return &targetSpec{
 		Kind:         kind,
 		GroupVersion: groupVer,
+		Resource:     plural,
 		Namespace:    namespace,
 		Name:         name,
 		patcher:      patcher,
 	}, nil
 }
 
-func (tgt *targetSpec) Patch(client kubernetes.Interface, pt types.PatchType, data []byte) error {
-	return tgt.patcher(client, tgt.Namespace, tgt.Name, pt, data)
+func (tgt *targetSpec) Patch(client kubernetes.Interface, target Target, pt types.PatchType, data []byte) error {
+	return tgt.patcher(client, target.Namespace, target.Name, pt, data)
+}
+
+func (tgt *targetSpec) GroupVersionResource() (schema.GroupVersionResource, error) {
+	gv, err := schema.ParseGroupVersion(tgt.GroupVersion)
+	if err != nil {
+		return schema.GroupVersionResource{}, err
+	}
+	return gv.WithResource(tgt.Resource), nil
 }
 
 // findPatcher returns a groupVersion string and a patch function for the
@@ -210,6 +405,13 @@ func findPatcher(kind string, groupVersions map[string]bool) (string, patchFunc,
 	return "", nil, fmt.Errorf("unknown target kind: %s", kind)
 }
 
+// SupportsAPIVersion returns whether a kind can be scaled through an API
+// group-version, such as apps/v1.
+func SupportsAPIVersion(kind, apiVersion string) bool {
+	_, _, err := findPatcher(kind, map[string]bool{apiVersion: true})
+	return err == nil
+}
+
 func findDeploymentPatcher(groupVersions map[string]bool) (string, patchFunc, error) {
 	// Find the best API to use - newest API first.
 	if groupVersions["apps/v1"] {
@@ -299,12 +501,72 @@ func findReplicaSetPatcher(groupVersions map[string]bool) (string, patchFunc, er
 type ClusterSize struct {
 	Nodes int
 	Cores int
+	// Memory is the memory capacity of the nodes in bytes.
+	Memory int64
+	// NodeSizes holds the size and labels of each node, from which the size
+	// of a topology domain is counted.
+	NodeSizes []NodeSize
+}
+
+// NodeSize is the number of cores of one node, along with its labels and
+// allocatable resources.
+type NodeSize struct {
+	Labels      map[string]string
+	MilliCores  int64
+	Memory      int64
+	Allocatable apiv1.ResourceList
+}
+
+// MinAllocatable returns the smallest allocatable quantity of a resource
+// among the nodes which have it.  It is not found without NodeSizes, as when
+// simulating a cluster size.
+func (c *ClusterSize) MinAllocatable(name apiv1.ResourceName) (resource.Quantity, bool) {
+	var min resource.Quantity
+	found := false
+	for _, node := range c.NodeSizes {
+		q, ok := node.Allocatable[name]
+		if !ok {
+			continue
+		}
+		if !found || q.Cmp(min) < 0 {
+			min = q
+			found = true
+		}
+	}
+	return min, found
+}
+
+// ForTopology returns the size of the part of the cluster whose nodes have a
+// label, such as the nodes of one zone.  Cores are rounded down.  Without
+// NodeSizes, as when simulating a cluster size, the whole cluster size is
+// returned.
+func (c *ClusterSize) ForTopology(key, value string) *ClusterSize {
+	if c.NodeSizes == nil {
+		return c
+	}
+	size := &ClusterSize{NodeSizes: []NodeSize{}}
+	var milliCores int64
+	for _, node := range c.NodeSizes {
+		if v, found := node.Labels[key]; !found || v != value {
+			continue
+		}
+		size.Nodes++
+		milliCores += node.MilliCores
+		size.Memory += node.Memory
+		size.NodeSizes = append(size.NodeSizes, node)
+	}
+	size.Cores = int(milliCores / 1000)
+	return size
 }
 
 func (k *k8sClient) GetClusterSize() (clusterStatus *ClusterSize, err error) {
 	opt := metav1.ListOptions{Watch: false}
 
-	nodes, err := k.clientset.CoreV1().Nodes().List(context.TODO(), opt)
+	var nodes *apiv1.NodeList
+	err = retryAPICall("list nodes", func() (err error) {
+		nodes, err = k.clientset.CoreV1().Nodes().List(context.TODO(), opt)
+		return err
+	})
 	if err != nil || nodes == nil {
 		return nil, err
 	}
@@ -313,8 +575,18 @@ func (k *k8sClient) GetClusterSize() (clusterStatus *ClusterSize, err error) {
 	var tc resource.Quantity
 	// All nodes are considered, even those that are marked as unshedulable,
 	// this includes the master.
+	clusterStatus.NodeSizes = make([]NodeSize, 0, len(nodes.Items))
 	for _, node := range nodes.Items {
-		tc.Add(node.Status.Capacity[apiv1.ResourceCPU])
+		cores := node.Status.Capacity[apiv1.ResourceCPU]
+		tc.Add(cores)
+		memory := node.Status.Capacity[apiv1.ResourceMemory]
+		clusterStatus.Memory += memory.Value()
+		clusterStatus.NodeSizes = append(clusterStatus.NodeSizes, NodeSize{
+			Labels:      node.Labels,
+			MilliCores:  cores.MilliValue(),
+			Memory:      memory.Value(),
+			Allocatable: node.Status.Allocatable,
+		})
 	}
 
 	tcInt64, tcOk := tc.AsInt64()
@@ -326,20 +598,162 @@ func (k *k8sClient) GetClusterSize() (clusterStatus *ClusterSize, err error) {
 	return clusterStatus, nil
 }
 
-func (k *k8sClient) UpdateResources(resources map[string]apiv1.ResourceRequirements) error {
+func (k *k8sClient) GetTargets() ([]Target, error) {
+	if k.target == nil && k.annotated == nil {
+		return nil, fmt.Errorf("targets are chosen by the caller")
+	}
+	if k.annotated != nil {
+		configs, err := k.GetTargetConfigs()
+		if err != nil {
+			return nil, err
+		}
+		targets := make([]Target, 0, len(configs))
+		for tgt := range configs {
+			targets = append(targets, tgt)
+		}
+		return targets, nil
+	}
+	if k.selector == nil {
+		return []Target{{Kind: k.target.Kind, Namespace: k.target.Namespace, Name: k.target.Name}}, nil
+	}
+
+	gvr, err := k.target.GroupVersionResource()
+	if err != nil {
+		return nil, err
+	}
+	opt := metav1.ListOptions{LabelSelector: k.selector.String()}
+	var list *unstructured.UnstructuredList
+	err = retryAPICall("list "+k.target.Resource, func() (err error) {
+		list, err = k.dynamicClient.Resource(gvr).Namespace(k.target.Namespace).List(context.TODO(), opt)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s matching %q: %w", k.target.Resource, k.selector, err)
+	}
+	targets := make([]Target, 0, len(list.Items))
+	for _, item := range list.Items {
+		targets = append(targets, Target{Kind: k.target.Kind, Namespace: item.GetNamespace(), Name: item.GetName(), UID: item.GetUID()})
+	}
+	return targets, nil
+}
+
+// targetSpecFor returns the targetSpec which handles objects of a kind.
+func (k *k8sClient) targetSpecFor(kind string) (*targetSpec, error) {
+	if k.target != nil && k.target.Kind == kind {
+		return k.target, nil
+	}
+	for _, spec := range k.kinds {
+		if spec.Kind == kind {
+			return spec, nil
+		}
+	}
+	for _, ak := range k.annotated {
+		if ak.spec.Kind == kind {
+			return ak.spec, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown target kind: %s", kind)
+}
+
+// getTarget reads the whole of a target object.
+func (k *k8sClient) getTarget(target Target) (*unstructured.Unstructured, error) {
+	spec, err := k.targetSpecFor(target.Kind)
+	if err != nil {
+		return nil, err
+	}
+	gvr, err := spec.GroupVersionResource()
+	if err != nil {
+		return nil, err
+	}
+	var obj *unstructured.Unstructured
+	err = retryAPICall("get "+target.String(), func() (err error) {
+		obj, err = k.dynamicClient.Resource(gvr).Namespace(target.Namespace).Get(context.TODO(), target.Name, metav1.GetOptions{})
+		return err
+	})
+	return obj, err
+}
+
+func (k *k8sClient) GetResources(target Target) (map[string]apiv1.ResourceRequirements, error) {
+	obj, err := k.getTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	return containerResources(obj, target)
+}
+
+// containerResources returns the resources of each container of a target
+// object.
+func containerResources(obj *unstructured.Unstructured, target Target) (map[string]apiv1.ResourceRequirements, error) {
+	ctrs, _, err := unstructured.NestedSlice(obj.Object, "spec", "template", "spec", "containers")
+	if err != nil {
+		return nil, fmt.Errorf("can't read containers of %s: %v", target, err)
+	}
+	resources := map[string]apiv1.ResourceRequirements{}
+	for _, c := range ctrs {
+		ctrObj, ok := c.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("can't read containers of %s: unexpected %T", target, c)
+		}
+		ctr := apiv1.Container{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(ctrObj, &ctr); err != nil {
+			return nil, fmt.Errorf("can't read containers of %s: %v", target, err)
+		}
+		resources[ctr.Name] = ctr.Resources
+	}
+	return resources, nil
+}
+
+func (k *k8sClient) UpdateResources(target Target, resources map[string]apiv1.ResourceRequirements) error {
+	spec, err := k.targetSpecFor(target.Kind)
+	if err != nil {
+		return err
+	}
+	metadata := map[string]interface{}{
+		"name": target.Name,
+	}
 	ctrs := []interface{}{}
-	for ctrName, res := range resources {
-		ctrs = append(ctrs, map[string]interface{}{
-			"name":      ctrName,
-			"resources": res,
-		})
+	if k.removeUnconfigured {
+		obj, err := k.getTarget(target)
+		if err != nil {
+			return fmt.Errorf("can't read the resources managed by cpvpa: %v", err)
+		}
+		var removed map[string]apiv1.ResourceRequirements
+		ctrs, removed, err = managedResourcesPatch(obj, target, resources)
+		if err != nil {
+			return err
+		}
+		for ctr, res := range removed {
+			for name := range res.Requests {
+				glog.V(0).Infof("Removing %s requests[%q] of %s, which is no longer configured", ctr, name, target)
+			}
+			for name := range res.Limits {
+				glog.V(0).Infof("Removing %s limits[%q] of %s, which is no longer configured", ctr, name, target)
+			}
+		}
+		managed, err := json.Marshal(newManagedResources(resources))
+		if err != nil {
+			return fmt.Errorf("can't marshal the managed resources to JSON: %v", err)
+		}
+		metadata["annotations"] = map[string]interface{}{ManagedResourcesAnnotation: string(managed)}
+	} else {
+		for ctrName, res := range resources {
+			ctrs = append(ctrs, map[string]interface{}{
+				"name":      ctrName,
+				"resources": res,
+			})
+		}
 	}
+	return k.patchContainers(spec, target, metadata, ctrs)
+}
+
+// patchContainers applies a strategic merge patch of the metadata and
+// containers of a target.
+func (k *k8sClient) patchContainers(spec *targetSpec, target Target, metadata map[string]interface{}, ctrs []interface{}) error {
+	k.stampLastUpdated(metadata)
 	patch := map[string]interface{}{
-		"apiVersion": k.target.GroupVersion,
-		"kind":       k.target.Kind,
-		"metadata": map[string]interface{}{
-			"name": k.target.Name,
-		},
+		"apiVersion": spec.GroupVersion,
+		"kind":       spec.Kind,
+		"metadata":   metadata,
 		"spec": map[string]interface{}{
 			"template": map[string]interface{}{
 				"spec": map[string]interface{}{
@@ -358,9 +772,26 @@ func (k *k8sClient) UpdateResources(resources map[string]apiv1.ResourceRequireme
 		glog.Infof("Performing dry-run, no updates will take affect.")
 		return nil
 	}
-	if err := k.target.Patch(k.clientset, types.StrategicMergePatchType, jb); err != nil {
-		return fmt.Errorf("patch failed: %v", err)
+	// The patch sets absolute values, so it can be retried as it is.
+	err = retryAPICall("patch "+target.String(), func() error {
+		return spec.Patch(k.clientset, target, types.StrategicMergePatchType, jb)
+	})
+	if err != nil {
+		return fmt.Errorf("patch failed: %w", err)
 	}
 
 	return nil
 }
+
+func (k *k8sClient) RecordEvent(target Target, eventType, reason, message string) {
+	ref := &apiv1.ObjectReference{
+		Kind:      target.Kind,
+		Namespace: target.Namespace,
+		Name:      target.Name,
+		UID:       target.UID,
+	}
+	if spec, err := k.targetSpecFor(target.Kind); err == nil {
+		ref.APIVersion = spec.GroupVersion
+	}
+	k.recorder.Event(ref, eventType, reason, message)
+}
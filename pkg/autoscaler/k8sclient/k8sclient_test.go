@@ -20,12 +20,18 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"sort"
 	"testing"
 
 	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
 	clientset "k8s.io/client-go/kubernetes"
 	restclient "k8s.io/client-go/rest"
 )
@@ -224,8 +230,171 @@ func TestUpdateResources(t *testing.T) {
 		r := resource.NewQuantity(0, resource.BinarySI)
 		r.SetMilli(10)
 		newReqs["thing"].Requests[apiv1.ResourceName("cpu")] = *r
-		if err := k8scli.UpdateResources(newReqs); err != nil {
+		if err := k8scli.UpdateResources(Target{Kind: target.Kind, Namespace: target.Namespace, Name: target.Name}, newReqs); err != nil {
 			t.Errorf("failed to update resources for target %q: %v", tc.target, err)
 		}
 	}
 }
+
+func TestGetTargets(t *testing.T) {
+	deployment := func(namespace, name string, labels map[string]interface{}) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata": map[string]interface{}{
+				"namespace": namespace,
+				"name":      name,
+				"labels":    labels,
+			},
+		}}
+	}
+	gvr := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{gvr: "DeploymentList"},
+		deployment("tenant-a", "thing", map[string]interface{}{"app": "thing"}),
+		deployment("tenant-b", "thing", map[string]interface{}{"app": "thing"}),
+		deployment("tenant-b", "other", map[string]interface{}{"app": "other"}),
+	)
+
+	testCases := []struct {
+		name       string
+		namespace  string
+		selector   string
+		expTargets []Target
+	}{
+		{
+			"one namespace",
+			"tenant-b",
+			"app=thing",
+			[]Target{{Kind: "Deployment", Namespace: "tenant-b", Name: "thing"}},
+		},
+		{
+			"all namespaces",
+			"",
+			"app=thing",
+			[]Target{{Kind: "Deployment", Namespace: "tenant-a", Name: "thing"}, {Kind: "Deployment", Namespace: "tenant-b", Name: "thing"}},
+		},
+		{
+			"no matches",
+			"",
+			"app=nothing",
+			[]Target{},
+		},
+	}
+
+	for _, tc := range testCases {
+		selector, err := labels.Parse(tc.selector)
+		if err != nil {
+			t.Fatalf("%s: invalid selector: %v", tc.name, err)
+		}
+		tgt, err := newTargetSpec("Deployment", map[string]bool{"apps/v1": true}, tc.namespace, "")
+		if err != nil {
+			t.Fatalf("%s: error making target: %v", tc.name, err)
+		}
+		k8scli := &k8sClient{
+			target:        tgt,
+			selector:      selector,
+			dynamicClient: dynamicClient,
+		}
+		targets, err := k8scli.GetTargets()
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		sort.Slice(targets, func(i, j int) bool { return targets[i].String() < targets[j].String() })
+		if !reflect.DeepEqual(targets, tc.expTargets) {
+			t.Errorf("%s: expected targets %v, got %v", tc.name, tc.expTargets, targets)
+		}
+	}
+}
+
+func TestGetResources(t *testing.T) {
+	daemonSet := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "DaemonSet",
+		"metadata": map[string]interface{}{
+			"namespace": "default",
+			"name":      "thing",
+		},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{
+							"name": "thing",
+							"resources": map[string]interface{}{
+								"requests": map[string]interface{}{"cpu": "100m"},
+								"limits":   map[string]interface{}{"memory": "1Gi"},
+							},
+						},
+						map[string]interface{}{"name": "sidecar"},
+					},
+				},
+			},
+		},
+	}}
+	spec, err := newTargetSpec("DaemonSet", map[string]bool{"apps/v1": true}, "default", "thing")
+	if err != nil {
+		t.Fatalf("error making target: %v", err)
+	}
+	k8scli := &k8sClient{
+		target:        spec,
+		dynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), daemonSet),
+	}
+
+	resources, err := k8scli.GetResources(Target{Kind: "DaemonSet", Namespace: "default", Name: "thing"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]apiv1.ResourceRequirements{
+		"thing": {
+			Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("100m")},
+			Limits:   apiv1.ResourceList{apiv1.ResourceMemory: resource.MustParse("1Gi")},
+		},
+		"sidecar": {},
+	}
+	if !reflect.DeepEqual(resources, expected) {
+		t.Errorf("expected %v, got %v", expected, resources)
+	}
+
+	if _, err := k8scli.GetResources(Target{Kind: "DaemonSet", Namespace: "default", Name: "missing"}); err == nil {
+		t.Errorf("expected an error for a missing target")
+	}
+}
+
+func TestClusterSizeForTopology(t *testing.T) {
+	zone := "topology.kubernetes.io/zone"
+	size := &ClusterSize{
+		Nodes: 4,
+		Cores: 14,
+		NodeSizes: []NodeSize{
+			{Labels: map[string]string{zone: "a"}, MilliCores: 4000, Memory: 16 << 30},
+			{Labels: map[string]string{zone: "a"}, MilliCores: 2500, Memory: 8 << 30},
+			{Labels: map[string]string{zone: "b"}, MilliCores: 4000, Memory: 16 << 30},
+			{Labels: map[string]string{}, MilliCores: 3500, Memory: 8 << 30},
+		},
+	}
+	for _, tc := range []struct {
+		key, value string
+		expNodes   int
+		expCores   int
+		expMemory  int64
+	}{
+		{zone, "a", 2, 6, 24 << 30},
+		{zone, "b", 1, 4, 16 << 30},
+		{zone, "c", 0, 0, 0},
+		{"example.com/pool", "a", 0, 0, 0},
+	} {
+		got := size.ForTopology(tc.key, tc.value)
+		if got.Nodes != tc.expNodes || got.Cores != tc.expCores || got.Memory != tc.expMemory {
+			t.Errorf("%s=%s: expected %d nodes, %d cores and %d bytes, got %d nodes, %d cores and %d bytes",
+				tc.key, tc.value, tc.expNodes, tc.expCores, tc.expMemory, got.Nodes, got.Cores, got.Memory)
+		}
+	}
+
+	// Without the nodes, the whole cluster size is used.
+	whole := &ClusterSize{Nodes: 4, Cores: 14}
+	if got := whole.ForTopology(zone, "a"); got.Nodes != 4 || got.Cores != 14 {
+		t.Errorf("expected the whole cluster size, got %d nodes and %d cores", got.Nodes, got.Cores)
+	}
+}
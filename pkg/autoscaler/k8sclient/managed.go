@@ -0,0 +1,180 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/golang/glog"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ManagedResourcesAnnotation records the resources of each container which
+// cpvpa last set on a target, so that those which are dropped from the config
+// can be removed, without touching resources which were set by anyone else.
+const ManagedResourcesAnnotation = "cpvpa.k8s.io/managed-resources"
+
+// managedResources maps container names to the resources set on them.
+type managedResources map[string]managedContainer
+
+type managedContainer struct {
+	Requests []string `json:"requests,omitempty"`
+	Limits   []string `json:"limits,omitempty"`
+}
+
+// newManagedResources returns the resources which are set by an update.
+func newManagedResources(resources map[string]apiv1.ResourceRequirements) managedResources {
+	managed := managedResources{}
+	for ctr, res := range resources {
+		managed[ctr] = managedContainer{
+			Requests: resourceNames(res.Requests),
+			Limits:   resourceNames(res.Limits),
+		}
+	}
+	return managed
+}
+
+func resourceNames(list apiv1.ResourceList) []string {
+	names := []string{}
+	for name := range list {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// managedResourcesPatch returns the containers of a strategic merge patch,
+// which sets the resources of each container and removes those recorded in
+// the ManagedResourcesAnnotation of the target object which are no longer
+// set.  Containers which are no longer in the target are left alone.  It also
+// returns the current values of the resources which it removes.
+func managedResourcesPatch(obj *unstructured.Unstructured, target Target, resources map[string]apiv1.ResourceRequirements) ([]interface{}, map[string]apiv1.ResourceRequirements, error) {
+	current, err := containerResources(obj, target)
+	if err != nil {
+		return nil, nil, err
+	}
+	previous := managedResources{}
+	if value, found := obj.GetAnnotations()[ManagedResourcesAnnotation]; found {
+		if err := json.Unmarshal([]byte(value), &previous); err != nil {
+			// Nothing is removed, and the annotation is replaced.
+			glog.Warningf("Ignoring invalid %s annotation of %s: %v", ManagedResourcesAnnotation, target, err)
+			previous = managedResources{}
+		}
+	}
+
+	ctrs := []interface{}{}
+	removed := map[string]apiv1.ResourceRequirements{}
+	for _, ctr := range sortedContainers(resources, previous) {
+		res, configured := resources[ctr]
+		if _, found := current[ctr]; !found && !configured {
+			continue
+		}
+		requests := resourceListPatch(res.Requests, previous[ctr].Requests)
+		limits := resourceListPatch(res.Limits, previous[ctr].Limits)
+		if len(requests) == 0 && len(limits) == 0 {
+			continue
+		}
+		patch := map[string]interface{}{}
+		if len(requests) > 0 {
+			patch["requests"] = requests
+		}
+		if len(limits) > 0 {
+			patch["limits"] = limits
+		}
+		ctrRemoved := apiv1.ResourceRequirements{
+			Requests: currentValues(current[ctr].Requests, removedResources(res.Requests, previous[ctr].Requests)),
+			Limits:   currentValues(current[ctr].Limits, removedResources(res.Limits, previous[ctr].Limits)),
+		}
+		if len(ctrRemoved.Requests) > 0 || len(ctrRemoved.Limits) > 0 {
+			removed[ctr] = ctrRemoved
+		}
+		ctrs = append(ctrs, map[string]interface{}{
+			"name":      ctr,
+			"resources": patch,
+		})
+	}
+	return ctrs, removed, nil
+}
+
+// currentValues returns the named resources which are set in a list.
+func currentValues(list apiv1.ResourceList, names []string) apiv1.ResourceList {
+	values := apiv1.ResourceList{}
+	for _, name := range names {
+		if q, found := list[apiv1.ResourceName(name)]; found {
+			values[apiv1.ResourceName(name)] = q.DeepCopy()
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return values
+}
+
+// GetUnconfiguredResources returns the resources of each container which an
+// update to the given resources would remove.  There are none unless the
+// client removes unconfigured resources.
+func (k *k8sClient) GetUnconfiguredResources(target Target, resources map[string]apiv1.ResourceRequirements) (map[string]apiv1.ResourceRequirements, error) {
+	if !k.removeUnconfigured {
+		return nil, nil
+	}
+	obj, err := k.getTarget(target)
+	if err != nil {
+		return nil, fmt.Errorf("can't read the resources managed by cpvpa: %v", err)
+	}
+	_, removed, err := managedResourcesPatch(obj, target, resources)
+	return removed, err
+}
+
+// resourceListPatch sets each resource in the list, and removes each of the
+// previously managed resources which is not.
+func resourceListPatch(list apiv1.ResourceList, previous []string) map[string]interface{} {
+	patch := map[string]interface{}{}
+	for name, q := range list {
+		patch[string(name)] = q.String()
+	}
+	for _, name := range removedResources(list, previous) {
+		patch[name] = nil
+	}
+	return patch
+}
+
+func removedResources(list apiv1.ResourceList, previous []string) []string {
+	removed := []string{}
+	for _, name := range previous {
+		if _, found := list[apiv1.ResourceName(name)]; !found {
+			removed = append(removed, name)
+		}
+	}
+	return removed
+}
+
+func sortedContainers(resources map[string]apiv1.ResourceRequirements, previous managedResources) []string {
+	names := []string{}
+	for ctr := range resources {
+		names = append(names, ctr)
+	}
+	for ctr := range previous {
+		if _, found := resources[ctr]; !found {
+			names = append(names, ctr)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
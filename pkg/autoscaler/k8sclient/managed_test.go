@@ -0,0 +1,149 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestUpdateResourcesRemovesUnconfigured(t *testing.T) {
+	deployment := &appsv1.Deployment{
+		TypeMeta: metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "thing",
+			Annotations: map[string]string{
+				ManagedResourcesAnnotation: `{"thing":{"requests":["cpu","memory"],"limits":["memory"]},"old":{"requests":["cpu"]},"gone":{"requests":["cpu"]}}`,
+			},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Template: apiv1.PodTemplateSpec{
+				Spec: apiv1.PodSpec{
+					Containers: []apiv1.Container{
+						{
+							Name: "thing",
+							Resources: apiv1.ResourceRequirements{
+								Requests: apiv1.ResourceList{
+									apiv1.ResourceCPU:    resource.MustParse("100m"),
+									apiv1.ResourceMemory: resource.MustParse("64Mi"),
+								},
+								Limits: apiv1.ResourceList{
+									apiv1.ResourceMemory: resource.MustParse("128Mi"),
+								},
+							},
+						},
+						{
+							Name: "old",
+							Resources: apiv1.ResourceRequirements{
+								Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("10m")},
+							},
+						},
+						{
+							// Not managed by cpvpa, so left alone.
+							Name: "sidecar",
+							Resources: apiv1.ResourceRequirements{
+								Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("5m")},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(deployment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := fake.NewSimpleClientset(deployment)
+	spec, err := newTargetSpec("Deployment", map[string]bool{"apps/v1": true}, "default", "thing")
+	if err != nil {
+		t.Fatalf("error making target: %v", err)
+	}
+	k8scli := &k8sClient{
+		target:             spec,
+		clientset:          client,
+		dynamicClient:      dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), &unstructured.Unstructured{Object: obj}),
+		removeUnconfigured: true,
+	}
+
+	newReqs := map[string]apiv1.ResourceRequirements{
+		"thing": {
+			Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("200m")},
+		},
+	}
+	target := Target{Kind: "Deployment", Namespace: "default", Name: "thing"}
+	removed, err := k8scli.GetUnconfiguredResources(target, newReqs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expRemoved := map[string]apiv1.ResourceRequirements{
+		"thing": {
+			Requests: apiv1.ResourceList{apiv1.ResourceMemory: resource.MustParse("64Mi")},
+			Limits:   apiv1.ResourceList{apiv1.ResourceMemory: resource.MustParse("128Mi")},
+		},
+		"old": {
+			Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("10m")},
+		},
+	}
+	if !apiequality.Semantic.DeepEqual(removed, expRemoved) {
+		t.Errorf("expected removed resources %v, got %v", expRemoved, removed)
+	}
+
+	if err := k8scli.UpdateResources(target, newReqs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	updated, err := client.AppsV1().Deployments("default").Get(context.TODO(), "thing", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]apiv1.ResourceRequirements{}
+	for _, ctr := range updated.Spec.Template.Spec.Containers {
+		got[ctr.Name] = ctr.Resources
+	}
+	expected := map[string]apiv1.ResourceRequirements{
+		"thing": {
+			Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("200m")},
+			Limits:   apiv1.ResourceList{},
+		},
+		"old": {
+			Requests: apiv1.ResourceList{},
+		},
+		"sidecar": {
+			Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("5m")},
+		},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected resources %v, got %v", expected, got)
+	}
+	expAnnotation := `{"thing":{"requests":["cpu"]}}`
+	if got := updated.Annotations[ManagedResourcesAnnotation]; got != expAnnotation {
+		t.Errorf("expected %s annotation %s, got %s", ManagedResourcesAnnotation, expAnnotation, got)
+	}
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"context"
+	"fmt"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ResourcePolicy holds the LimitRanges and ResourceQuotas of the namespace of
+// a target, along with the number of pods and the current resources of the
+// target, against which new resources are checked.
+type ResourcePolicy struct {
+	LimitRanges    []apiv1.LimitRange
+	ResourceQuotas []apiv1.ResourceQuota
+	// Pods is the number of pods which the target runs.
+	Pods      int64
+	Resources map[string]apiv1.ResourceRequirements
+}
+
+func (k *k8sClient) GetResourcePolicy(target Target) (*ResourcePolicy, error) {
+	obj, err := k.getTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	resources, err := containerResources(obj, target)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := podCount(obj, target)
+	if err != nil {
+		return nil, err
+	}
+	var limitRanges *apiv1.LimitRangeList
+	err = retryAPICall("list LimitRanges", func() (err error) {
+		limitRanges, err = k.clientset.CoreV1().LimitRanges(target.Namespace).List(context.TODO(), metav1.ListOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't list LimitRanges: %w", err)
+	}
+	var quotas *apiv1.ResourceQuotaList
+	err = retryAPICall("list ResourceQuotas", func() (err error) {
+		quotas, err = k.clientset.CoreV1().ResourceQuotas(target.Namespace).List(context.TODO(), metav1.ListOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't list ResourceQuotas: %w", err)
+	}
+	return &ResourcePolicy{
+		LimitRanges:    limitRanges.Items,
+		ResourceQuotas: quotas.Items,
+		Pods:           pods,
+		Resources:      resources,
+	}, nil
+}
+
+// podCount returns the number of pods of a target: the replicas of a
+// Deployment or ReplicaSet, or the pods which a DaemonSet should schedule.
+func podCount(obj *unstructured.Unstructured, target Target) (int64, error) {
+	if target.Kind == "DaemonSet" {
+		pods, _, err := unstructured.NestedInt64(obj.Object, "status", "desiredNumberScheduled")
+		if err != nil {
+			return 0, fmt.Errorf("can't read the pods of %s: %v", target, err)
+		}
+		return pods, nil
+	}
+	pods, found, err := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+	if err != nil {
+		return 0, fmt.Errorf("can't read the replicas of %s: %v", target, err)
+	}
+	if !found {
+		return 1, nil
+	}
+	return pods, nil
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGetResourcePolicy(t *testing.T) {
+	object := func(kind, name string, fields map[string]interface{}) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       kind,
+			"metadata": map[string]interface{}{
+				"namespace": "default",
+				"name":      name,
+			},
+			"spec": map[string]interface{}{
+				"template": map[string]interface{}{
+					"spec": map[string]interface{}{
+						"containers": []interface{}{map[string]interface{}{"name": name}},
+					},
+				},
+			},
+		}}
+		for path, value := range fields {
+			if err := unstructured.SetNestedField(obj.Object, value, "spec", path); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return obj
+	}
+	deployment := object("Deployment", "thing", map[string]interface{}{"replicas": int64(3)})
+	defaulted := object("Deployment", "defaulted", nil)
+	daemonSet := object("DaemonSet", "agent", nil)
+	if err := unstructured.SetNestedField(daemonSet.Object, int64(5), "status", "desiredNumberScheduled"); err != nil {
+		t.Fatal(err)
+	}
+
+	clientset := fake.NewSimpleClientset(
+		&apiv1.LimitRange{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "limits"}},
+		&apiv1.ResourceQuota{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "quota"}},
+		&apiv1.ResourceQuota{ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "quota"}},
+	)
+	for _, tc := range []struct {
+		kind    string
+		name    string
+		expPods int64
+	}{
+		{"Deployment", "thing", 3},
+		{"Deployment", "defaulted", 1},
+		{"DaemonSet", "agent", 5},
+	} {
+		spec, err := newTargetSpec(tc.kind, map[string]bool{"apps/v1": true}, "default", "")
+		if err != nil {
+			t.Fatalf("error making target: %v", err)
+		}
+		k8scli := &k8sClient{
+			kinds:         []*targetSpec{spec},
+			clientset:     clientset,
+			dynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), deployment, defaulted, daemonSet),
+		}
+		policy, err := k8scli.GetResourcePolicy(Target{Kind: tc.kind, Namespace: "default", Name: tc.name})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if policy.Pods != tc.expPods {
+			t.Errorf("%s: expected %d pods, got %d", tc.name, tc.expPods, policy.Pods)
+		}
+		if len(policy.LimitRanges) != 1 || len(policy.ResourceQuotas) != 1 {
+			t.Errorf("%s: expected the LimitRange and ResourceQuota of the namespace, got %v and %v", tc.name, policy.LimitRanges, policy.ResourceQuotas)
+		}
+		if _, found := policy.Resources[tc.name]; !found {
+			t.Errorf("%s: expected the resources of the target, got %v", tc.name, policy.Resources)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/golang/glog"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+)
+
+// apiBackoff is how an API call which fails transiently is retried within a
+// poll: up to 5 attempts over about 3 seconds, jittered so that many
+// autoscalers don't retry in step.  Longer outages are left to the next poll.
+// There is no Cap, since reaching it would end the retries early.
+var apiBackoff = wait.Backoff{
+	Duration: 200 * time.Millisecond,
+	Factor:   2,
+	Jitter:   0.5,
+	Steps:    5,
+}
+
+// IsRetriable returns whether an API call which failed with err may succeed
+// if it is retried unchanged: a conflict, throttling, a timeout, an error of
+// the API server itself, or a connection which failed.  Any other response of
+// the API server, such as NotFound or Forbidden, is permanent.
+//
+// A response which asks the client to wait, such as throttling (429) with a
+// Retry-After, is not retried here: the rest client has already retried it
+// after the delay which the server asked for, so retrying it again on a
+// shorter backoff would only add to the load.  The rest client does not retry
+// throttling without a Retry-After, so that is retried here.
+func IsRetriable(err error) bool {
+	var status apierrors.APIStatus
+	if errors.As(err, &status) {
+		if _, delayed := apierrors.SuggestsClientDelay(err); delayed {
+			return false
+		}
+		return apierrors.IsConflict(err) ||
+			apierrors.IsTooManyRequests(err) ||
+			apierrors.IsTimeout(err) ||
+			apierrors.IsServiceUnavailable(err) ||
+			apierrors.IsInternalError(err) ||
+			apierrors.IsUnexpectedServerError(err)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return utilnet.IsConnectionRefused(err) || utilnet.IsConnectionReset(err) || utilnet.IsProbableEOF(err)
+}
+
+// retryAPICall calls fn until it succeeds, fails permanently, or runs out of
+// retries, and returns its last error.
+func retryAPICall(op string, fn func() error) error {
+	attempt := 1
+	return retry.OnError(apiBackoff, func(err error) bool {
+		if !IsRetriable(err) {
+			return false
+		}
+		glog.Warningf("Failed to %s (attempt %d), retrying: %v", op, attempt, err)
+		attempt++
+		return true
+	}, fn)
+}
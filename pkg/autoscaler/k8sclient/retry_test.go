@@ -0,0 +1,146 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestIsRetriable(t *testing.T) {
+	deployments := schema.GroupResource{Group: "apps", Resource: "deployments"}
+	for _, tc := range []struct {
+		name     string
+		err      error
+		expRetry bool
+	}{
+		{"conflict", apierrors.NewConflict(deployments, "thing", errors.New("changed")), true},
+		{"timeout", apierrors.NewTimeoutError("timed out", 0), true},
+		{"unavailable", apierrors.NewServiceUnavailable("unavailable"), true},
+		{"internal error", apierrors.NewInternalError(errors.New("oops")), true},
+		{"wrapped", fmt.Errorf("patch failed: %w", apierrors.NewConflict(deployments, "thing", errors.New("changed"))), true},
+		{"connection refused", fmt.Errorf("dial: %w", syscall.ECONNREFUSED), true},
+		{"connection reset", fmt.Errorf("read: %w", syscall.ECONNRESET), true},
+		{"eof", io.ErrUnexpectedEOF, true},
+		{"throttled", apierrors.NewTooManyRequests("slow down", 0), true},
+		{"throttled with retry after", apierrors.NewTooManyRequests("slow down", 1), false},
+		{"server timeout", apierrors.NewServerTimeout(deployments, "patch", 1), false},
+		{"timeout with retry after", apierrors.NewTimeoutError("timed out", 1), false},
+		{"unavailable with retry after", &apierrors.StatusError{ErrStatus: metav1.Status{
+			Status:  metav1.StatusFailure,
+			Code:    http.StatusServiceUnavailable,
+			Reason:  metav1.StatusReasonServiceUnavailable,
+			Details: &metav1.StatusDetails{RetryAfterSeconds: 5},
+		}}, false},
+		{"not found", apierrors.NewNotFound(deployments, "thing"), false},
+		{"forbidden", apierrors.NewForbidden(deployments, "thing", errors.New("no")), false},
+		{"unauthorized", apierrors.NewUnauthorized("who are you"), false},
+		{"invalid", apierrors.NewBadRequest("bad patch"), false},
+		{"other", errors.New("unknown target kind"), false},
+	} {
+		if got := IsRetriable(tc.err); got != tc.expRetry {
+			t.Errorf("%s: expected retriable %t, got %t", tc.name, tc.expRetry, got)
+		}
+	}
+}
+
+func TestUpdateResourcesRetries(t *testing.T) {
+	defer func(backoff wait.Backoff) { apiBackoff = backoff }(apiBackoff)
+	apiBackoff.Duration = time.Millisecond
+
+	testCases := []struct {
+		name        string
+		errs        []error
+		expAttempts int
+		expError    bool
+	}{
+		{
+			name:        "internal error then conflict",
+			errs:        []error{apierrors.NewInternalError(errors.New("oops")), apierrors.NewConflict(schema.GroupResource{Group: "apps", Resource: "deployments"}, "thing", errors.New("changed"))},
+			expAttempts: 3,
+		},
+		{
+			// Already retried by the rest client.
+			name:        "throttled with retry after",
+			errs:        []error{apierrors.NewTooManyRequests("slow down", 1)},
+			expAttempts: 1,
+			expError:    true,
+		},
+		{
+			name:        "forbidden",
+			errs:        []error{apierrors.NewForbidden(schema.GroupResource{Group: "apps", Resource: "deployments"}, "thing", errors.New("no"))},
+			expAttempts: 1,
+			expError:    true,
+		},
+		{
+			name: "unavailable",
+			errs: []error{
+				apierrors.NewServiceUnavailable("unavailable"),
+				apierrors.NewServiceUnavailable("unavailable"),
+				apierrors.NewServiceUnavailable("unavailable"),
+				apierrors.NewServiceUnavailable("unavailable"),
+				apierrors.NewServiceUnavailable("unavailable"),
+			},
+			expAttempts: 5,
+			expError:    true,
+		},
+	}
+	for _, tc := range testCases {
+		client := fake.NewSimpleClientset(&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "thing"}})
+		attempts := 0
+		client.PrependReactor("patch", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			attempts++
+			if attempts <= len(tc.errs) {
+				return true, nil, tc.errs[attempts-1]
+			}
+			return false, nil, nil
+		})
+		spec, err := newTargetSpec("Deployment", map[string]bool{"apps/v1": true}, "default", "thing")
+		if err != nil {
+			t.Fatalf("error making target: %v", err)
+		}
+		k8scli := &k8sClient{target: spec, clientset: client}
+
+		err = k8scli.UpdateResources(Target{Kind: "Deployment", Namespace: "default", Name: "thing"}, map[string]apiv1.ResourceRequirements{
+			"thing": {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("100m")}},
+		})
+		if err != nil && !tc.expError {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		} else if err == nil && tc.expError {
+			t.Errorf("%s: expected error, got none", tc.name)
+		}
+		if attempts != tc.expAttempts {
+			t.Errorf("%s: expected %d attempts, got %d", tc.name, tc.expAttempts, attempts)
+		}
+	}
+}
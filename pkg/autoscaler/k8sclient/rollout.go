@@ -0,0 +1,132 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"fmt"
+	"sort"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// RolloutStatus is the progress of the rollout of the latest change to the
+// pod template of a target.
+type RolloutStatus struct {
+	Complete bool
+	// Message describes why the rollout is not complete.
+	Message string
+}
+
+func (k *k8sClient) GetRolloutStatus(target Target) (*RolloutStatus, error) {
+	obj, err := k.getTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	return rolloutStatus(obj, target)
+}
+
+// rolloutStatus decides whether a rollout is complete in the same way as
+// kubectl rollout status: the controller has seen the latest generation, and
+// every pod is updated and available.  Changing the template of a ReplicaSet
+// or of an OnDelete DaemonSet does not replace its pods, so there is nothing
+// to wait for.
+func rolloutStatus(obj *unstructured.Unstructured, target Target) (*RolloutStatus, error) {
+	status := func(fields ...string) (int64, error) {
+		n, _, err := unstructured.NestedInt64(obj.Object, append([]string{"status"}, fields...)...)
+		if err != nil {
+			return 0, fmt.Errorf("can't read the status of %s: %v", target, err)
+		}
+		return n, nil
+	}
+	observed, err := status("observedGeneration")
+	if err != nil {
+		return nil, err
+	}
+	if observed < obj.GetGeneration() {
+		return &RolloutStatus{Message: "waiting for the latest generation to be observed"}, nil
+	}
+
+	switch target.Kind {
+	case "Deployment":
+		want, err := podCount(obj, target)
+		if err != nil {
+			return nil, err
+		}
+		counts := map[string]int64{}
+		for _, f := range []string{"replicas", "updatedReplicas", "availableReplicas"} {
+			if counts[f], err = status(f); err != nil {
+				return nil, err
+			}
+		}
+		switch {
+		case counts["updatedReplicas"] < want:
+			return &RolloutStatus{Message: fmt.Sprintf("%d of %d replicas are updated", counts["updatedReplicas"], want)}, nil
+		case counts["replicas"] > counts["updatedReplicas"]:
+			return &RolloutStatus{Message: fmt.Sprintf("%d old replicas are pending termination", counts["replicas"]-counts["updatedReplicas"])}, nil
+		case counts["availableReplicas"] < counts["updatedReplicas"]:
+			return &RolloutStatus{Message: fmt.Sprintf("%d of %d updated replicas are available", counts["availableReplicas"], counts["updatedReplicas"])}, nil
+		}
+	case "DaemonSet":
+		strategy, _, _ := unstructured.NestedString(obj.Object, "spec", "updateStrategy", "type")
+		if strategy == "OnDelete" {
+			return &RolloutStatus{Complete: true}, nil
+		}
+		counts := map[string]int64{}
+		for _, f := range []string{"desiredNumberScheduled", "updatedNumberScheduled", "numberAvailable"} {
+			if counts[f], err = status(f); err != nil {
+				return nil, err
+			}
+		}
+		switch {
+		case counts["updatedNumberScheduled"] < counts["desiredNumberScheduled"]:
+			return &RolloutStatus{Message: fmt.Sprintf("%d of %d pods are updated", counts["updatedNumberScheduled"], counts["desiredNumberScheduled"])}, nil
+		case counts["numberAvailable"] < counts["desiredNumberScheduled"]:
+			return &RolloutStatus{Message: fmt.Sprintf("%d of %d pods are available", counts["numberAvailable"], counts["desiredNumberScheduled"])}, nil
+		}
+	}
+	return &RolloutStatus{Complete: true}, nil
+}
+
+// RevertResources sets the resources of each container to exactly those
+// given, removing any others, rather than merging them like UpdateResources.
+func (k *k8sClient) RevertResources(target Target, resources map[string]apiv1.ResourceRequirements) error {
+	spec, err := k.targetSpecFor(target.Kind)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(resources))
+	for ctr := range resources {
+		names = append(names, ctr)
+	}
+	sort.Strings(names)
+	ctrs := []interface{}{}
+	for _, ctr := range names {
+		res := map[string]interface{}{"$patch": "replace"}
+		if len(resources[ctr].Requests) > 0 {
+			res["requests"] = resources[ctr].Requests
+		}
+		if len(resources[ctr].Limits) > 0 {
+			res["limits"] = resources[ctr].Limits
+		}
+		ctrs = append(ctrs, map[string]interface{}{
+			"name":      ctr,
+			"resources": res,
+		})
+	}
+	return k.patchContainers(spec, target, map[string]interface{}{"name": target.Name}, ctrs)
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sclient
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRolloutStatus(t *testing.T) {
+	object := func(generation int64, spec, status map[string]interface{}) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"spec":   spec,
+			"status": status,
+		}}
+		obj.SetGeneration(generation)
+		return obj
+	}
+	testCases := []struct {
+		name        string
+		kind        string
+		obj         *unstructured.Unstructured
+		expComplete bool
+		expMessage  string
+	}{
+		{
+			name:        "deployment complete",
+			kind:        "Deployment",
+			obj:         object(2, map[string]interface{}{"replicas": int64(3)}, map[string]interface{}{"observedGeneration": int64(2), "replicas": int64(3), "updatedReplicas": int64(3), "availableReplicas": int64(3)}),
+			expComplete: true,
+		},
+		{
+			name:       "deployment not observed",
+			kind:       "Deployment",
+			obj:        object(3, map[string]interface{}{"replicas": int64(3)}, map[string]interface{}{"observedGeneration": int64(2), "replicas": int64(3), "updatedReplicas": int64(3), "availableReplicas": int64(3)}),
+			expMessage: "waiting for the latest generation to be observed",
+		},
+		{
+			name:       "deployment updating",
+			kind:       "Deployment",
+			obj:        object(2, map[string]interface{}{"replicas": int64(3)}, map[string]interface{}{"observedGeneration": int64(2), "replicas": int64(4), "updatedReplicas": int64(1), "availableReplicas": int64(3)}),
+			expMessage: "1 of 3 replicas are updated",
+		},
+		{
+			name:       "deployment terminating old replicas",
+			kind:       "Deployment",
+			obj:        object(2, map[string]interface{}{"replicas": int64(3)}, map[string]interface{}{"observedGeneration": int64(2), "replicas": int64(4), "updatedReplicas": int64(3), "availableReplicas": int64(3)}),
+			expMessage: "1 old replicas are pending termination",
+		},
+		{
+			name:       "deployment unavailable",
+			kind:       "Deployment",
+			obj:        object(2, map[string]interface{}{"replicas": int64(3)}, map[string]interface{}{"observedGeneration": int64(2), "replicas": int64(3), "updatedReplicas": int64(3), "availableReplicas": int64(1)}),
+			expMessage: "1 of 3 updated replicas are available",
+		},
+		{
+			name:        "daemonset complete",
+			kind:        "DaemonSet",
+			obj:         object(1, map[string]interface{}{}, map[string]interface{}{"observedGeneration": int64(1), "desiredNumberScheduled": int64(5), "updatedNumberScheduled": int64(5), "numberAvailable": int64(5)}),
+			expComplete: true,
+		},
+		{
+			name:       "daemonset unavailable",
+			kind:       "DaemonSet",
+			obj:        object(1, map[string]interface{}{}, map[string]interface{}{"observedGeneration": int64(1), "desiredNumberScheduled": int64(5), "updatedNumberScheduled": int64(5), "numberAvailable": int64(4)}),
+			expMessage: "4 of 5 pods are available",
+		},
+		{
+			name:        "daemonset on delete",
+			kind:        "DaemonSet",
+			obj:         object(1, map[string]interface{}{"updateStrategy": map[string]interface{}{"type": "OnDelete"}}, map[string]interface{}{"observedGeneration": int64(1), "desiredNumberScheduled": int64(5)}),
+			expComplete: true,
+		},
+		{
+			name:        "replicaset",
+			kind:        "ReplicaSet",
+			obj:         object(1, map[string]interface{}{"replicas": int64(3)}, map[string]interface{}{"observedGeneration": int64(1)}),
+			expComplete: true,
+		},
+	}
+	for _, tc := range testCases {
+		status, err := rolloutStatus(tc.obj, Target{Kind: tc.kind, Namespace: "default", Name: "thing"})
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if status.Complete != tc.expComplete || status.Message != tc.expMessage {
+			t.Errorf("%s: expected complete %t with message %q, got %+v", tc.name, tc.expComplete, tc.expMessage, status)
+		}
+	}
+}
+
+func TestRevertResources(t *testing.T) {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "thing"},
+		Spec: appsv1.DeploymentSpec{
+			Template: apiv1.PodTemplateSpec{
+				Spec: apiv1.PodSpec{
+					Containers: []apiv1.Container{
+						{
+							Name: "thing",
+							Resources: apiv1.ResourceRequirements{
+								Requests: apiv1.ResourceList{
+									apiv1.ResourceCPU:    resource.MustParse("200m"),
+									apiv1.ResourceMemory: resource.MustParse("64Mi"),
+								},
+								Limits: apiv1.ResourceList{apiv1.ResourceMemory: resource.MustParse("128Mi")},
+							},
+						},
+						{
+							Name: "sidecar",
+							Resources: apiv1.ResourceRequirements{
+								Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("5m")},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	client := fake.NewSimpleClientset(deployment)
+	spec, err := newTargetSpec("Deployment", map[string]bool{"apps/v1": true}, "default", "thing")
+	if err != nil {
+		t.Fatalf("error making target: %v", err)
+	}
+	k8scli := &k8sClient{target: spec, clientset: client}
+
+	// Resources which were added since are removed, and other containers
+	// are left alone.
+	previous := map[string]apiv1.ResourceRequirements{
+		"thing": {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("100m")}},
+	}
+	if err := k8scli.RevertResources(Target{Kind: "Deployment", Namespace: "default", Name: "thing"}, previous); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	updated, err := client.AppsV1().Deployments("default").Get(context.TODO(), "thing", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]apiv1.ResourceRequirements{}
+	for _, ctr := range updated.Spec.Template.Spec.Containers {
+		got[ctr.Name] = ctr.Resources
+	}
+	expected := map[string]apiv1.ResourceRequirements{
+		"thing": {
+			Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("100m")},
+		},
+		"sidecar": {
+			Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("5m")},
+		},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected resources %v, got %v", expected, got)
+	}
+}
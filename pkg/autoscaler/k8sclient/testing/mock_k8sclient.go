@@ -17,6 +17,8 @@ limitations under the License.
 package k8sclient
 
 import (
+	"time"
+
 	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
 	apiv1 "k8s.io/api/core/v1"
 )
@@ -27,14 +29,99 @@ var _ = k8sclient.K8sClient(&MockK8sClient{})
 type MockK8sClient struct {
 	NumOfNodes int
 	NumOfCores int
+	// NodeSizes holds the size and labels of each node, if they are needed.
+	NodeSizes []k8sclient.NodeSize
+	Targets   []k8sclient.Target
+	Configs   map[k8sclient.Target]string
+	// Resources holds the current resources of each target.
+	Resources map[k8sclient.Target]map[string]apiv1.ResourceRequirements
+	// Unconfigured holds the resources which an update would remove from
+	// each target.
+	Unconfigured map[k8sclient.Target]map[string]apiv1.ResourceRequirements
+	// Updates records the resources most recently set on each target.
+	Updates map[k8sclient.Target]map[string]apiv1.ResourceRequirements
+	// Events records the reasons of the events recorded on each target.
+	Events map[k8sclient.Target][]string
+	// Policies holds the namespace policy of each target, if it has one.
+	Policies map[k8sclient.Target]*k8sclient.ResourcePolicy
+	// Rollouts holds the rollout status of each target, which is complete
+	// if it is not set.
+	Rollouts map[k8sclient.Target]*k8sclient.RolloutStatus
+	// Reverts records the resources most recently reverted on each target.
+	Reverts map[k8sclient.Target]map[string]apiv1.ResourceRequirements
+	// LastUpdated holds the recorded time of the last update of each target.
+	LastUpdated map[k8sclient.Target]time.Time
 }
 
 // GetClusterSize mocks counting schedulable nodes and cores in the cluster
 func (k *MockK8sClient) GetClusterSize() (*k8sclient.ClusterSize, error) {
-	return &k8sclient.ClusterSize{Nodes: k.NumOfNodes, Cores: k.NumOfCores}, nil
+	return &k8sclient.ClusterSize{Nodes: k.NumOfNodes, Cores: k.NumOfCores, NodeSizes: k.NodeSizes}, nil
+}
+
+// GetTargets mocks listing the objects whose resources should be scaled
+func (k *MockK8sClient) GetTargets() ([]k8sclient.Target, error) {
+	return k.Targets, nil
+}
+
+// GetTargetConfigs mocks listing the objects which carry the config annotation
+func (k *MockK8sClient) GetTargetConfigs() (map[k8sclient.Target]string, error) {
+	return k.Configs, nil
+}
+
+// GetResources mocks reading the current resources of the target
+func (k *MockK8sClient) GetResources(target k8sclient.Target) (map[string]apiv1.ResourceRequirements, error) {
+	return k.Resources[target], nil
 }
 
 // UpdateResources mocks updating resources needs for containers in the target
-func (k *MockK8sClient) UpdateResources(resources map[string]apiv1.ResourceRequirements) error {
+func (k *MockK8sClient) UpdateResources(target k8sclient.Target, resources map[string]apiv1.ResourceRequirements) error {
+	if k.Updates == nil {
+		k.Updates = map[k8sclient.Target]map[string]apiv1.ResourceRequirements{}
+	}
+	k.Updates[target] = resources
+	return nil
+}
+
+// GetUnconfiguredResources mocks reading the resources which an update would
+// remove from the target
+func (k *MockK8sClient) GetUnconfiguredResources(target k8sclient.Target, resources map[string]apiv1.ResourceRequirements) (map[string]apiv1.ResourceRequirements, error) {
+	return k.Unconfigured[target], nil
+}
+
+// RevertResources mocks reverting the resources of containers in the target
+func (k *MockK8sClient) RevertResources(target k8sclient.Target, resources map[string]apiv1.ResourceRequirements) error {
+	if k.Reverts == nil {
+		k.Reverts = map[k8sclient.Target]map[string]apiv1.ResourceRequirements{}
+	}
+	k.Reverts[target] = resources
 	return nil
 }
+
+// GetLastUpdated mocks reading when the resources of the target were last set
+func (k *MockK8sClient) GetLastUpdated(target k8sclient.Target) (time.Time, error) {
+	return k.LastUpdated[target], nil
+}
+
+// GetRolloutStatus mocks reading the rollout status of the target
+func (k *MockK8sClient) GetRolloutStatus(target k8sclient.Target) (*k8sclient.RolloutStatus, error) {
+	if status, found := k.Rollouts[target]; found {
+		return status, nil
+	}
+	return &k8sclient.RolloutStatus{Complete: true}, nil
+}
+
+// GetResourcePolicy mocks reading the namespace policy of the target
+func (k *MockK8sClient) GetResourcePolicy(target k8sclient.Target) (*k8sclient.ResourcePolicy, error) {
+	if policy, found := k.Policies[target]; found {
+		return policy, nil
+	}
+	return &k8sclient.ResourcePolicy{Pods: 1, Resources: k.Resources[target]}, nil
+}
+
+// RecordEvent mocks recording an event on the target
+func (k *MockK8sClient) RecordEvent(target k8sclient.Target, eventType, reason, message string) {
+	if k.Events == nil {
+		k.Events = map[k8sclient.Target][]string{}
+	}
+	k.Events[target] = append(k.Events[target], reason)
+}
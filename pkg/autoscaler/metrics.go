@@ -0,0 +1,59 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	configLastReloadSuccessful = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cpvpa_config_last_reload_successful",
+		Help: "Whether the last attempt to load the config succeeded. While it is 0, the last good config is used.",
+	})
+	configLastReloadSuccessTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cpvpa_config_last_reload_success_timestamp_seconds",
+		Help: "When the config was last loaded successfully, in seconds since the epoch.",
+	})
+	configReloadFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "cpvpa_config_reload_failures_total",
+		Help: "Number of distinct invalid configs which failed to load.",
+	})
+	invalidTargetConfigs = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cpvpa_invalid_target_configs",
+		Help: "Number of targets whose config annotation is invalid.",
+	})
+	calculationErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "cpvpa_calculation_errors_total",
+		Help: "Number of times resources could not be computed, such as when a quantity overflows.",
+	})
+	rollbacks = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "cpvpa_rollbacks_total",
+		Help: "Number of updates which were reverted because they did not roll out within the --rollout-deadline.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		configLastReloadSuccessful,
+		configLastReloadSuccessTimestamp,
+		configReloadFailures,
+		invalidTargetConfigs,
+		calculationErrors,
+		rollbacks,
+	)
+}
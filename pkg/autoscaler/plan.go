@@ -0,0 +1,144 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+
+	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+)
+
+// TargetPlan holds the resources which a poll would set on one target.
+type TargetPlan struct {
+	Target k8sclient.Target
+	// Current holds the resources of every container of the target.
+	Current map[string]apiv1.ResourceRequirements
+	// Desired holds the resources which a poll would set on each container
+	// in the config.
+	Desired map[string]apiv1.ResourceRequirements
+	// Clamped describes each resource which was clamped to the namespace
+	// policy.
+	Clamped []string
+	// Pending holds the containers whose new resources are held until their
+	// maintenance window opens at PendingUntil, which is zero if it never
+	// does.  Their desired resources are their current ones.
+	Pending      []string
+	PendingUntil time.Time
+	// Removed holds the current values of the resources which an update
+	// would remove, since cpvpa set them but they are no longer in the
+	// config.
+	Removed map[string]apiv1.ResourceRequirements
+	// Err is set if either could not be found, such as when the config
+	// annotation of the target is invalid, or if a poll would not update the
+	// target, such as when it would conflict with the namespace policy.
+	Err error
+
+	// The config which the resources were computed from.
+	config ScaleConfig
+}
+
+// Plan computes the resources of every target for the current cluster size,
+// in the same way as a poll, including the namespace policy and maintenance
+// windows, and reads their current resources, but does not update anything.
+// The plans are ordered by target.
+func (s *AutoScaler) Plan() (*k8sclient.ClusterSize, []TargetPlan, error) {
+	clusterSize, err := s.k8sClient.GetClusterSize()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting cluster size: %v", err)
+	}
+
+	plans := []TargetPlan{}
+	if s.annotatedTargets {
+		configs, err := s.k8sClient.GetTargetConfigs()
+		if err != nil {
+			return nil, nil, fmt.Errorf("error getting target configs: %v", err)
+		}
+		for tgt, raw := range configs {
+			cfg := ScaleConfig{}
+			plan := TargetPlan{Target: tgt}
+			if err := ParseScaleConfig([]byte(raw), &cfg); err != nil {
+				plan.Err = fmt.Errorf("invalid %s annotation: %v", k8sclient.ConfigAnnotation, err)
+			} else {
+				plan.config = cfg
+				plan.Desired, plan.Err = ComputeRequirements(cfg, clusterSize)
+			}
+			plans = append(plans, plan)
+		}
+	} else {
+		targets, err := s.k8sClient.GetTargets()
+		if err != nil {
+			return nil, nil, fmt.Errorf("error getting targets: %v", err)
+		}
+		if err := s.refreshConfig(); err != nil {
+			return nil, nil, err
+		}
+		newReqs, err := ComputeRequirements(s.currentConfig, clusterSize)
+		for _, tgt := range targets {
+			plans = append(plans, TargetPlan{Target: tgt, Desired: newReqs, Err: err, config: s.currentConfig})
+		}
+	}
+
+	for i := range plans {
+		if plans[i].Err != nil {
+			continue
+		}
+		plans[i].Current, plans[i].Err = s.k8sClient.GetResources(plans[i].Target)
+		if plans[i].Err != nil {
+			continue
+		}
+		if plans[i].Err = s.planNamespacePolicy(&plans[i]); plans[i].Err != nil {
+			continue
+		}
+		if plans[i].config.hasMaintenanceWindows() {
+			plans[i].Desired, plans[i].Pending, plans[i].PendingUntil, plans[i].Err = HoldOutsideMaintenanceWindows(plans[i].config, s.clock.Now(), plans[i].Desired, func() (map[string]apiv1.ResourceRequirements, error) {
+				return plans[i].Current, nil
+			})
+			if plans[i].Err != nil {
+				continue
+			}
+		}
+		plans[i].Removed, plans[i].Err = s.k8sClient.GetUnconfiguredResources(plans[i].Target, plans[i].Desired)
+	}
+	sort.Slice(plans, func(i, j int) bool { return plans[i].Target.String() < plans[j].Target.String() })
+	return clusterSize, plans, nil
+}
+
+// planNamespacePolicy checks the desired resources of a plan against the
+// namespace policy of its target, as a poll does.
+func (s *AutoScaler) planNamespacePolicy(plan *TargetPlan) error {
+	policy, err := s.namespacePolicyFor(plan.Target)
+	if err != nil {
+		return fmt.Errorf("failed to read the namespace policy: %v", err)
+	}
+	if policy == nil {
+		return nil
+	}
+	// The quotas are checked against the current resources which were read
+	// with the plan.
+	withCurrent := *policy
+	withCurrent.Resources = plan.Current
+	desired, clamped, err := EnforceNamespacePolicy(s.namespacePolicy, &withCurrent, plan.Desired)
+	if err != nil {
+		return fmt.Errorf("would conflict with the namespace policy: %v", err)
+	}
+	plan.Desired, plan.Clamped = desired, clamped
+	return nil
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/cmd/cpvpa/options"
+	k8sclientapi "github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+	k8sclient "github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient/testing"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func TestPlan(t *testing.T) {
+	cfg, err := LoadConfig(`{"thing":{"requests":{"cpu":{"base":"10m","step":"1m","nodesPerStep":1}}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenantA := k8sclientapi.Target{Kind: "Deployment", Namespace: "tenant-a", Name: "thing"}
+	tenantB := k8sclientapi.Target{Kind: "Deployment", Namespace: "tenant-b", Name: "thing"}
+	current := map[string]apiv1.ResourceRequirements{
+		"thing": {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("100m")}},
+	}
+	mockK8s := &k8sclient.MockK8sClient{
+		NumOfNodes: 4,
+		NumOfCores: 8,
+		Targets:    []k8sclientapi.Target{tenantB, tenantA},
+		Resources:  map[k8sclientapi.Target]map[string]apiv1.ResourceRequirements{tenantA: current, tenantB: current},
+		Unconfigured: map[k8sclientapi.Target]map[string]apiv1.ResourceRequirements{
+			tenantA: {"thing": {Limits: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("1")}}},
+		},
+	}
+	autoScaler := &AutoScaler{
+		k8sClient:     mockK8s,
+		defaultConfig: cfg,
+	}
+
+	clusterSize, plans, err := autoScaler.Plan()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if clusterSize.Nodes != 4 || clusterSize.Cores != 8 {
+		t.Errorf("expected a cluster size of 4 nodes and 8 cores, got %v", clusterSize)
+	}
+	if len(plans) != 2 || plans[0].Target != tenantA || plans[1].Target != tenantB {
+		t.Fatalf("expected plans for %s and %s, got %v", tenantA, tenantB, plans)
+	}
+	for _, plan := range plans {
+		if plan.Err != nil {
+			t.Errorf("%s: unexpected error: %v", plan.Target, plan.Err)
+		}
+		if got := plan.Desired["thing"].Requests[apiv1.ResourceCPU]; got.MilliValue() != 14 {
+			t.Errorf("%s: expected a desired cpu request of 14m, got %v", plan.Target, &got)
+		}
+		if got := plan.Current["thing"].Requests[apiv1.ResourceCPU]; got.MilliValue() != 100 {
+			t.Errorf("%s: expected a current cpu request of 100m, got %v", plan.Target, &got)
+		}
+	}
+	if _, found := plans[0].Removed["thing"].Limits[apiv1.ResourceCPU]; !found {
+		t.Errorf("%s: expected the cpu limit to be removed, got %v", tenantA, plans[0].Removed)
+	}
+	if len(mockK8s.Updates) != 0 {
+		t.Errorf("expected no updates, got %v", mockK8s.Updates)
+	}
+}
+
+func TestPlanNamespacePolicy(t *testing.T) {
+	cfg, err := LoadConfig(`{"thing":{"requests":{"cpu":{"base":"10m","step":"1m","nodesPerStep":1}}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clamped := k8sclientapi.Target{Kind: "Deployment", Namespace: "tenant-a", Name: "thing"}
+	refused := k8sclientapi.Target{Kind: "Deployment", Namespace: "tenant-b", Name: "thing"}
+	current := map[string]apiv1.ResourceRequirements{
+		"thing": {Requests: resourceList("cpu", "10m")},
+	}
+	mockK8s := &k8sclient.MockK8sClient{
+		NumOfNodes: 4,
+		NumOfCores: 8,
+		Targets:    []k8sclientapi.Target{clamped, refused},
+		Resources:  map[k8sclientapi.Target]map[string]apiv1.ResourceRequirements{clamped: current, refused: current},
+		Policies: map[k8sclientapi.Target]*k8sclientapi.ResourcePolicy{
+			clamped: {
+				LimitRanges: []apiv1.LimitRange{limitRange(apiv1.LimitRangeItem{Max: resourceList("cpu", "12m")})},
+				Pods:        1,
+			},
+			refused: {
+				ResourceQuotas: []apiv1.ResourceQuota{resourceQuota(resourceList("requests.cpu", "1"), resourceList("requests.cpu", "999m"))},
+				Pods:           1,
+			},
+		},
+	}
+	autoScaler := &AutoScaler{
+		k8sClient:       mockK8s,
+		defaultConfig:   cfg,
+		namespacePolicy: options.NamespacePolicyClamp,
+	}
+
+	_, plans, err := autoScaler.Plan()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(plans) != 2 {
+		t.Fatalf("expected 2 plans, got %v", plans)
+	}
+	if plans[0].Err != nil {
+		t.Errorf("%s: unexpected error: %v", clamped, plans[0].Err)
+	}
+	if got := plans[0].Desired["thing"].Requests[apiv1.ResourceCPU]; got.MilliValue() != 12 {
+		t.Errorf("%s: expected cpu to be clamped to 12m, got %v", clamped, &got)
+	}
+	if len(plans[0].Clamped) != 1 {
+		t.Errorf("%s: expected 1 clamped resource, got %v", clamped, plans[0].Clamped)
+	}
+	if plans[1].Err == nil || !strings.Contains(plans[1].Err.Error(), "namespace policy") {
+		t.Errorf("%s: expected a namespace policy conflict, got %v", refused, plans[1].Err)
+	}
+}
+
+func TestPlanMaintenanceWindow(t *testing.T) {
+	raw := `{"thing":{"requests":{"cpu":{"base":"10m","step":"1m","nodesPerStep":1}},"maintenanceWindow":{"schedule":"0 2 * * *","duration":"1h","timeZone":"UTC"}}}`
+	cfg, err := LoadConfig(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tgt := k8sclientapi.Target{Kind: "Deployment", Namespace: "tenant-a", Name: "thing"}
+	current := map[string]apiv1.ResourceRequirements{
+		"thing": {Requests: resourceList("cpu", "100m")},
+	}
+	for _, tc := range []struct {
+		name      string
+		annotated bool
+	}{
+		{"default config", false},
+		{"annotated targets", true},
+	} {
+		mockK8s := &k8sclient.MockK8sClient{
+			NumOfNodes: 4,
+			NumOfCores: 8,
+			Resources:  map[k8sclientapi.Target]map[string]apiv1.ResourceRequirements{tgt: current},
+		}
+		autoScaler := &AutoScaler{
+			k8sClient:        mockK8s,
+			annotatedTargets: tc.annotated,
+			clock:            clocktesting.NewFakeClock(time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)),
+		}
+		if tc.annotated {
+			mockK8s.Configs = map[k8sclientapi.Target]string{tgt: raw}
+		} else {
+			mockK8s.Targets = []k8sclientapi.Target{tgt}
+			autoScaler.defaultConfig = cfg
+		}
+
+		_, plans, err := autoScaler.Plan()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if len(plans) != 1 || plans[0].Err != nil {
+			t.Fatalf("%s: expected 1 plan without an error, got %v", tc.name, plans)
+		}
+		if len(plans[0].Pending) != 1 || plans[0].Pending[0] != "thing" {
+			t.Errorf("%s: expected thing to be pending, got %v", tc.name, plans[0].Pending)
+		}
+		if expected := time.Date(2024, 3, 6, 2, 0, 0, 0, time.UTC); !plans[0].PendingUntil.Equal(expected) {
+			t.Errorf("%s: expected to be pending until %v, got %v", tc.name, expected, plans[0].PendingUntil)
+		}
+		if got := plans[0].Desired["thing"].Requests[apiv1.ResourceCPU]; got.MilliValue() != 100 {
+			t.Errorf("%s: expected the cpu request to be held at 100m, got %v", tc.name, &got)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/cmd/cpvpa/options"
+	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+)
+
+// EnforceNamespacePolicy checks new resources against the LimitRanges and
+// ResourceQuotas of the namespace of a target, which would otherwise reject
+// its pods only once they are created.
+//
+// With NamespacePolicyClamp, resources outside the min, max or max ratio of a
+// LimitRange of type Container are clamped to it.  Otherwise, or if clamping
+// can't satisfy every LimitRange, an error is returned.  An increase which
+// would exceed a ResourceQuota is always refused, since the quota is shared
+// with the rest of the namespace.  Quotas with scopes are not checked.
+//
+// It returns the resources to set, and a description of each clamped one.
+func EnforceNamespacePolicy(mode string, policy *k8sclient.ResourcePolicy, newReqs map[string]apiv1.ResourceRequirements) (map[string]apiv1.ResourceRequirements, []string, error) {
+	if mode == "" || mode == options.NamespacePolicyIgnore {
+		return newReqs, nil, nil
+	}
+	reqs := map[string]apiv1.ResourceRequirements{}
+	for ctr, res := range newReqs {
+		reqs[ctr] = *res.DeepCopy()
+	}
+
+	clamp := mode == options.NamespacePolicyClamp
+	clamped, violations := checkLimitRanges(policy, reqs, clamp)
+	if clamp {
+		// Clamping to one limit can break another, such as a min which is
+		// above the max of another LimitRange.
+		_, violations = checkLimitRanges(policy, reqs, false)
+	}
+	violations = append(violations, checkResourceQuotas(policy, reqs)...)
+	if len(violations) > 0 {
+		errs := make([]error, 0, len(violations))
+		for _, v := range violations {
+			errs = append(errs, fmt.Errorf("%s", v))
+		}
+		return nil, clamped, utilerrors.NewAggregate(errs)
+	}
+	return reqs, clamped, nil
+}
+
+// checkLimitRanges returns the resources which are outside the LimitRanges of
+// type Container, after clamping them if clamp is set.  Only the resources in
+// reqs are checked, so those set by anyone else are left alone.
+func checkLimitRanges(policy *k8sclient.ResourcePolicy, reqs map[string]apiv1.ResourceRequirements, clamp bool) (clamped, violations []string) {
+	report := func(msg string) {
+		if clamp {
+			clamped = append(clamped, msg)
+		} else {
+			violations = append(violations, msg)
+		}
+	}
+	for _, lr := range policy.LimitRanges {
+		for _, item := range lr.Spec.Limits {
+			if item.Type != apiv1.LimitTypeContainer {
+				continue
+			}
+			for _, ctr := range sortedNames(reqs) {
+				res := reqs[ctr]
+				for _, list := range []struct {
+					kind string
+					list apiv1.ResourceList
+				}{{"requests", res.Requests}, {"limits", res.Limits}} {
+					for _, name := range sortedResources(list.list) {
+						q := list.list[name]
+						if max, found := item.Max[name]; found && q.Cmp(max) > 0 {
+							report(fmt.Sprintf("%s %s[%q] %s is above the max %s of LimitRange %s", ctr, list.kind, name, &q, &max, lr.Name))
+							if clamp {
+								list.list[name] = max.DeepCopy()
+							}
+						}
+						q = list.list[name]
+						if min, found := item.Min[name]; found && q.Cmp(min) < 0 {
+							report(fmt.Sprintf("%s %s[%q] %s is below the min %s of LimitRange %s", ctr, list.kind, name, &q, &min, lr.Name))
+							if clamp {
+								list.list[name] = min.DeepCopy()
+							}
+						}
+					}
+				}
+				for _, name := range sortedResources(item.MaxLimitRequestRatio) {
+					ratio := item.MaxLimitRequestRatio[name]
+					if msg := clampLimitRequestRatio(ctr, name, ratio, res, policy.Resources[ctr], clamp); msg != "" {
+						report(fmt.Sprintf("%s of LimitRange %s", msg, lr.Name))
+					}
+				}
+			}
+		}
+	}
+	return clamped, violations
+}
+
+// clampLimitRequestRatio checks the ratio of the limit to the request of one
+// resource of a container, where either may be set by cpvpa and the other by
+// the target.  A computed limit is lowered, or else a computed request is
+// raised.  It returns a description of the violation, if there is one.
+func clampLimitRequestRatio(ctr string, name apiv1.ResourceName, ratio resource.Quantity, res, current apiv1.ResourceRequirements, clamp bool) string {
+	request, computedRequest := res.Requests[name]
+	if !computedRequest {
+		request = current.Requests[name]
+	}
+	limit, computedLimit := res.Limits[name]
+	if !computedLimit {
+		limit = current.Limits[name]
+	}
+	if !computedRequest && !computedLimit || request.IsZero() || limit.IsZero() {
+		return ""
+	}
+	max := float64(request.MilliValue()) * ratio.AsApproximateFloat64()
+	if float64(limit.MilliValue()) <= max {
+		return ""
+	}
+	if clamp {
+		if computedLimit {
+			q := resource.NewQuantity(0, limit.Format)
+			q.SetMilli(int64(math.Floor(max)))
+			res.Limits[name] = *q
+		} else {
+			q := resource.NewQuantity(0, request.Format)
+			q.SetMilli(int64(math.Ceil(float64(limit.MilliValue()) / ratio.AsApproximateFloat64())))
+			res.Requests[name] = *q
+		}
+	}
+	return fmt.Sprintf("%s limits[%q] %s is more than %s times requests[%q] %s", ctr, name, &limit, &ratio, name, &request)
+}
+
+// checkResourceQuotas returns the quotas which the increase in the resources
+// of every pod of the target would exceed.
+func checkResourceQuotas(policy *k8sclient.ResourcePolicy, reqs map[string]apiv1.ResourceRequirements) []string {
+	violations := []string{}
+	for _, quota := range policy.ResourceQuotas {
+		if len(quota.Spec.Scopes) > 0 || quota.Spec.ScopeSelector != nil {
+			glog.V(2).Infof("Not checking ResourceQuota %s, which has scopes", quota.Name)
+			continue
+		}
+		for _, name := range sortedResources(quota.Spec.Hard) {
+			kind, res := quotaResource(name)
+			if kind == "" {
+				continue
+			}
+			var increase int64
+			for ctr, r := range reqs {
+				list, current := r.Requests, policy.Resources[ctr].Requests
+				if kind == "limits" {
+					list, current = r.Limits, policy.Resources[ctr].Limits
+				}
+				if q, found := list[res]; found {
+					old := current[res]
+					increase += q.MilliValue() - old.MilliValue()
+				}
+			}
+			if increase <= 0 {
+				continue
+			}
+			hard := quota.Spec.Hard[name]
+			used := quota.Status.Used[name]
+			// Floats can't overflow, and only need to be close to compare.
+			if float64(used.MilliValue())+float64(increase)*float64(policy.Pods) <= float64(hard.MilliValue()) {
+				continue
+			}
+			violations = append(violations, fmt.Sprintf("an increase in %s of %s for each of %d pods would exceed the %s of ResourceQuota %s, of which %s is used",
+				name, resource.NewMilliQuantity(increase, hard.Format), policy.Pods, &hard, quota.Name, &used))
+		}
+	}
+	return violations
+}
+
+// quotaResource returns whether a quota limits the requests or the limits of
+// a resource, and which resource.  Plain cpu, memory and ephemeral-storage
+// quotas limit requests.
+func quotaResource(name apiv1.ResourceName) (kind string, res apiv1.ResourceName) {
+	switch {
+	case strings.HasPrefix(string(name), "requests."):
+		return "requests", apiv1.ResourceName(strings.TrimPrefix(string(name), "requests."))
+	case strings.HasPrefix(string(name), "limits."):
+		return "limits", apiv1.ResourceName(strings.TrimPrefix(string(name), "limits."))
+	case name == apiv1.ResourceCPU || name == apiv1.ResourceMemory || name == apiv1.ResourceEphemeralStorage:
+		return "requests", name
+	}
+	return "", ""
+}
+
+func sortedNames(reqs map[string]apiv1.ResourceRequirements) []string {
+	names := make([]string, 0, len(reqs))
+	for name := range reqs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedResources(list apiv1.ResourceList) []apiv1.ResourceName {
+	names := make([]apiv1.ResourceName, 0, len(list))
+	for name := range list {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
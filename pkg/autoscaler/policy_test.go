@@ -0,0 +1,251 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/cmd/cpvpa/options"
+	k8sclientapi "github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+	k8sclient "github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient/testing"
+)
+
+func resourceList(pairs ...string) apiv1.ResourceList {
+	list := apiv1.ResourceList{}
+	for i := 0; i < len(pairs); i += 2 {
+		list[apiv1.ResourceName(pairs[i])] = resource.MustParse(pairs[i+1])
+	}
+	return list
+}
+
+func limitRange(item apiv1.LimitRangeItem) apiv1.LimitRange {
+	item.Type = apiv1.LimitTypeContainer
+	return apiv1.LimitRange{
+		ObjectMeta: metav1.ObjectMeta{Name: "limits"},
+		Spec:       apiv1.LimitRangeSpec{Limits: []apiv1.LimitRangeItem{item}},
+	}
+}
+
+func resourceQuota(hard, used apiv1.ResourceList) apiv1.ResourceQuota {
+	return apiv1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "quota"},
+		Spec:       apiv1.ResourceQuotaSpec{Hard: hard},
+		Status:     apiv1.ResourceQuotaStatus{Hard: hard, Used: used},
+	}
+}
+
+func TestEnforceNamespacePolicy(t *testing.T) {
+	newReqs := map[string]apiv1.ResourceRequirements{
+		"thing": {
+			Requests: resourceList("cpu", "2", "memory", "100Mi"),
+			Limits:   resourceList("memory", "400Mi"),
+		},
+	}
+	current := map[string]apiv1.ResourceRequirements{
+		"thing": {Requests: resourceList("cpu", "1", "memory", "100Mi")},
+	}
+
+	testCases := []struct {
+		name        string
+		mode        string
+		policy      k8sclientapi.ResourcePolicy
+		expReqs     map[string]apiv1.ResourceRequirements
+		expClamped  int
+		expErrorSub string
+	}{
+		{
+			name:    "no policy",
+			mode:    options.NamespacePolicyClamp,
+			expReqs: newReqs,
+		},
+		{
+			name: "ignored",
+			mode: options.NamespacePolicyIgnore,
+			policy: k8sclientapi.ResourcePolicy{
+				LimitRanges: []apiv1.LimitRange{limitRange(apiv1.LimitRangeItem{Max: resourceList("cpu", "1")})},
+			},
+			expReqs: newReqs,
+		},
+		{
+			name: "max clamped",
+			mode: options.NamespacePolicyClamp,
+			policy: k8sclientapi.ResourcePolicy{
+				LimitRanges: []apiv1.LimitRange{limitRange(apiv1.LimitRangeItem{Max: resourceList("cpu", "1500m", "memory", "300Mi")})},
+			},
+			expReqs: map[string]apiv1.ResourceRequirements{
+				"thing": {
+					Requests: resourceList("cpu", "1500m", "memory", "100Mi"),
+					Limits:   resourceList("memory", "300Mi"),
+				},
+			},
+			expClamped: 2,
+		},
+		{
+			name: "min clamped",
+			mode: options.NamespacePolicyClamp,
+			policy: k8sclientapi.ResourcePolicy{
+				LimitRanges: []apiv1.LimitRange{limitRange(apiv1.LimitRangeItem{Min: resourceList("memory", "128Mi")})},
+			},
+			expReqs: map[string]apiv1.ResourceRequirements{
+				"thing": {
+					Requests: resourceList("cpu", "2", "memory", "128Mi"),
+					Limits:   resourceList("memory", "400Mi"),
+				},
+			},
+			expClamped: 1,
+		},
+		{
+			name: "ratio clamped",
+			mode: options.NamespacePolicyClamp,
+			policy: k8sclientapi.ResourcePolicy{
+				LimitRanges: []apiv1.LimitRange{limitRange(apiv1.LimitRangeItem{MaxLimitRequestRatio: resourceList("memory", "2")})},
+			},
+			expReqs: map[string]apiv1.ResourceRequirements{
+				"thing": {
+					Requests: resourceList("cpu", "2", "memory", "100Mi"),
+					Limits:   resourceList("memory", "200Mi"),
+				},
+			},
+			expClamped: 1,
+		},
+		{
+			name: "max refused",
+			mode: options.NamespacePolicyRefuse,
+			policy: k8sclientapi.ResourcePolicy{
+				LimitRanges: []apiv1.LimitRange{limitRange(apiv1.LimitRangeItem{Max: resourceList("cpu", "1500m")})},
+			},
+			expErrorSub: `thing requests["cpu"] 2 is above the max 1500m of LimitRange limits`,
+		},
+		{
+			name: "min above another max",
+			mode: options.NamespacePolicyClamp,
+			policy: k8sclientapi.ResourcePolicy{
+				LimitRanges: []apiv1.LimitRange{
+					limitRange(apiv1.LimitRangeItem{Max: resourceList("cpu", "1")}),
+					limitRange(apiv1.LimitRangeItem{Min: resourceList("cpu", "3")}),
+				},
+			},
+			expClamped:  2,
+			expErrorSub: `thing requests["cpu"] 3 is above the max 1`,
+		},
+		{
+			name: "within quota",
+			mode: options.NamespacePolicyClamp,
+			policy: k8sclientapi.ResourcePolicy{
+				ResourceQuotas: []apiv1.ResourceQuota{resourceQuota(resourceList("requests.cpu", "10"), resourceList("requests.cpu", "7"))},
+				Pods:           3,
+				Resources:      current,
+			},
+			expReqs: newReqs,
+		},
+		{
+			name: "quota exceeded",
+			mode: options.NamespacePolicyClamp,
+			policy: k8sclientapi.ResourcePolicy{
+				ResourceQuotas: []apiv1.ResourceQuota{resourceQuota(resourceList("cpu", "10", "limits.memory", "10Gi"), resourceList("cpu", "8"))},
+				Pods:           3,
+				Resources:      current,
+			},
+			expErrorSub: "an increase in cpu of 1 for each of 3 pods would exceed the 10 of ResourceQuota quota, of which 8 is used",
+		},
+		{
+			name: "scoped quota",
+			mode: options.NamespacePolicyClamp,
+			policy: k8sclientapi.ResourcePolicy{
+				ResourceQuotas: []apiv1.ResourceQuota{func() apiv1.ResourceQuota {
+					q := resourceQuota(resourceList("cpu", "1"), resourceList("cpu", "1"))
+					q.Spec.Scopes = []apiv1.ResourceQuotaScope{apiv1.ResourceQuotaScopeBestEffort}
+					return q
+				}()},
+				Pods:      3,
+				Resources: current,
+			},
+			expReqs: newReqs,
+		},
+	}
+
+	for _, tc := range testCases {
+		reqs, clamped, err := EnforceNamespacePolicy(tc.mode, &tc.policy, newReqs)
+		if tc.expErrorSub != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.expErrorSub) {
+				t.Errorf("%s: expected error containing %q, got %v", tc.name, tc.expErrorSub, err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+		} else if !apiequality.Semantic.DeepEqual(reqs, tc.expReqs) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expReqs, reqs)
+		}
+		if len(clamped) != tc.expClamped {
+			t.Errorf("%s: expected %d clamped, got %v", tc.name, tc.expClamped, clamped)
+		}
+	}
+	// The new resources are not changed in place.
+	if q := newReqs["thing"].Requests[apiv1.ResourceCPU]; q.String() != "2" {
+		t.Errorf("expected the new resources to be left alone, got cpu %s", &q)
+	}
+}
+
+func TestPollAPIServerNamespacePolicy(t *testing.T) {
+	cfg := ScaleConfig{}
+	if err := ParseScaleConfig([]byte(`{"thing":{"requests":{"cpu":{"base":"1","step":"1","nodesPerStep":1}}}}`), &cfg); err != nil {
+		t.Fatalf("invalid default config: %v", err)
+	}
+	tgt := k8sclientapi.Target{Kind: "Deployment", Namespace: "default", Name: "thing"}
+	policy := &k8sclientapi.ResourcePolicy{
+		LimitRanges: []apiv1.LimitRange{limitRange(apiv1.LimitRangeItem{Max: resourceList("cpu", "3")})},
+		Pods:        1,
+	}
+	mockK8s := &k8sclient.MockK8sClient{
+		NumOfNodes: 4,
+		NumOfCores: 8,
+		Targets:    []k8sclientapi.Target{tgt},
+		Policies:   map[k8sclientapi.Target]*k8sclientapi.ResourcePolicy{tgt: policy},
+	}
+	autoScaler := &AutoScaler{
+		k8sClient:       mockK8s,
+		defaultConfig:   cfg,
+		namespacePolicy: options.NamespacePolicyRefuse,
+	}
+
+	// The conflict is reported once, and nothing is updated.
+	autoScaler.pollAPIServer()
+	autoScaler.pollAPIServer()
+	if len(mockK8s.Updates) != 0 {
+		t.Errorf("expected no updates, got %v", mockK8s.Updates)
+	}
+	if exp := []string{"NamespacePolicyConflict"}; !reflect.DeepEqual(mockK8s.Events[tgt], exp) {
+		t.Errorf("expected events %v, got %v", exp, mockK8s.Events[tgt])
+	}
+
+	// Clamped resources are applied, and reported when they are.
+	autoScaler.namespacePolicy = options.NamespacePolicyClamp
+	autoScaler.pollAPIServer()
+	autoScaler.pollAPIServer()
+	if q := mockK8s.Updates[tgt]["thing"].Requests[apiv1.ResourceCPU]; q.String() != "3" {
+		t.Errorf("expected cpu to be clamped to 3, got %s", &q)
+	}
+	if exp := []string{"NamespacePolicyConflict", "ResourcesClamped"}; !reflect.DeepEqual(mockK8s.Events[tgt], exp) {
+		t.Errorf("expected events %v, got %v", exp, mockK8s.Events[tgt])
+	}
+}
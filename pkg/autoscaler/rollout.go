@@ -0,0 +1,105 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+)
+
+// rollout is an update of the resources of a target which has not finished
+// rolling out.
+type rollout struct {
+	// The resources of the updated containers before and after the update.
+	previous map[string]apiv1.ResourceRequirements
+	applied  map[string]apiv1.ResourceRequirements
+	started  time.Time
+	// Whether reverting the update failed, so it is not reported again.
+	revertFailed bool
+}
+
+// startRollout reads the resources of the containers which are about to be
+// updated, so the update can be reverted.
+func (s *AutoScaler) startRollout(tgt k8sclient.Target, newReqs map[string]apiv1.ResourceRequirements) (*rollout, error) {
+	current, err := s.k8sClient.GetResources(tgt)
+	if err != nil {
+		return nil, err
+	}
+	previous := map[string]apiv1.ResourceRequirements{}
+	for ctr := range newReqs {
+		if res, found := current[ctr]; found {
+			previous[ctr] = res
+		}
+	}
+	return &rollout{previous: previous, applied: newReqs}, nil
+}
+
+// checkRollouts forgets the updates which have rolled out, and reverts those
+// which have not rolled out within the deadline, such as when the new pods
+// are OOMKilled or never become ready.  A reverted update is not applied
+// again, until the computed resources change.
+func (s *AutoScaler) checkRollouts() {
+	for tgt, r := range s.rollouts {
+		status, err := s.k8sClient.GetRolloutStatus(tgt)
+		if apierrors.IsNotFound(err) {
+			delete(s.rollouts, tgt)
+			continue
+		}
+		if err != nil {
+			glog.Errorf("Failed to read the rollout status of %s: %v", tgt, err)
+			continue
+		}
+		if status.Complete {
+			glog.V(0).Infof("Rollout of the resources of %s completed", tgt)
+			delete(s.rollouts, tgt)
+			continue
+		}
+		elapsed := s.clock.Since(r.started)
+		if elapsed < s.rolloutDeadline {
+			glog.V(4).Infof("Waiting for the rollout of %s: %s", tgt, status.Message)
+			continue
+		}
+
+		glog.Warningf("Rollout of %s did not complete within %v (%s), reverting its resources", tgt, s.rolloutDeadline, status.Message)
+		if err := s.k8sClient.RevertResources(tgt, r.previous); err != nil {
+			glog.Errorf("Failed to revert the resources of %s: %v", tgt, err)
+			// Retried on the next poll.
+			if !r.revertFailed {
+				s.k8sClient.RecordEvent(tgt, apiv1.EventTypeWarning, "RollbackFailed",
+					fmt.Sprintf("Rollout did not complete within %v (%s), and reverting the resources failed: %v", s.rolloutDeadline, status.Message, err))
+			}
+			r.revertFailed = true
+			continue
+		}
+		rollbacks.Inc()
+		// Reverting rolls the pods too.
+		s.stampLastUpdated(tgt)
+		s.k8sClient.RecordEvent(tgt, apiv1.EventTypeWarning, "RolloutFailed",
+			fmt.Sprintf("Rollout did not complete within %v (%s), reverted the resources", s.rolloutDeadline, status.Message))
+		delete(s.rollouts, tgt)
+		if s.failedRollouts == nil {
+			s.failedRollouts = map[k8sclient.Target]map[string]apiv1.ResourceRequirements{}
+		}
+		s.failedRollouts[tgt] = r.applied
+	}
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	k8sclientapi "github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+	k8sclient "github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient/testing"
+)
+
+func TestPollAPIServerRolloutDeadline(t *testing.T) {
+	cfg := ScaleConfig{}
+	if err := ParseScaleConfig([]byte(`{"thing":{"requests":{"cpu":{"base":"1","step":"1","nodesPerStep":1}}}}`), &cfg); err != nil {
+		t.Fatalf("invalid default config: %v", err)
+	}
+	tgt := k8sclientapi.Target{Kind: "Deployment", Namespace: "default", Name: "thing"}
+	previous := map[string]apiv1.ResourceRequirements{
+		"thing":   {Requests: resourceList("cpu", "2")},
+		"sidecar": {Requests: resourceList("cpu", "5m")},
+	}
+	mockK8s := &k8sclient.MockK8sClient{
+		NumOfNodes: 4,
+		NumOfCores: 8,
+		Targets:    []k8sclientapi.Target{tgt},
+		Resources:  map[k8sclientapi.Target]map[string]apiv1.ResourceRequirements{tgt: previous},
+		Rollouts: map[k8sclientapi.Target]*k8sclientapi.RolloutStatus{
+			tgt: {Message: "0 of 1 updated replicas are available"},
+		},
+	}
+	fakeClock := clocktesting.NewFakeClock(time.Now())
+	autoScaler := &AutoScaler{
+		k8sClient:       mockK8s,
+		defaultConfig:   cfg,
+		clock:           fakeClock,
+		rolloutDeadline: 10 * time.Minute,
+		updateCooldown:  time.Minute,
+	}
+
+	// The update is left to roll out until the deadline.
+	autoScaler.pollAPIServer()
+	if q := mockK8s.Updates[tgt]["thing"].Requests[apiv1.ResourceCPU]; q.String() != "5" {
+		t.Fatalf("expected cpu to be updated to 5, got %s", &q)
+	}
+	fakeClock.Step(5 * time.Minute)
+	autoScaler.pollAPIServer()
+	if mockK8s.Reverts != nil {
+		t.Errorf("expected no revert before the deadline, got %v", mockK8s.Reverts)
+	}
+
+	// Then only the updated containers are reverted, and the update is not
+	// applied again.
+	fakeClock.Step(5 * time.Minute)
+	mockK8s.Updates = nil
+	autoScaler.pollAPIServer()
+	if exp := map[string]apiv1.ResourceRequirements{"thing": previous["thing"]}; !reflect.DeepEqual(mockK8s.Reverts[tgt], exp) {
+		t.Errorf("expected resources to be reverted to %v, got %v", exp, mockK8s.Reverts[tgt])
+	}
+	if exp := []string{"RolloutFailed"}; !reflect.DeepEqual(mockK8s.Events[tgt], exp) {
+		t.Errorf("expected events %v, got %v", exp, mockK8s.Events[tgt])
+	}
+	autoScaler.pollAPIServer()
+	if mockK8s.Updates != nil {
+		t.Errorf("expected the failed update not to be applied again, got %v", mockK8s.Updates)
+	}
+	if !autoScaler.lastUpdated[tgt].Equal(fakeClock.Now()) {
+		t.Errorf("expected the revert to start the cooldown at %v, got %v", fakeClock.Now(), autoScaler.lastUpdated[tgt])
+	}
+
+	// New resources are applied after the cooldown, and forgotten once they
+	// roll out.
+	fakeClock.Step(time.Minute)
+	mockK8s.NumOfNodes = 5
+	mockK8s.Rollouts = nil
+	autoScaler.pollAPIServer()
+	if q := mockK8s.Updates[tgt]["thing"].Requests[apiv1.ResourceCPU]; q.String() != "6" {
+		t.Errorf("expected cpu to be updated to 6, got %s", &q)
+	}
+	autoScaler.pollAPIServer()
+	if len(autoScaler.rollouts) != 0 {
+		t.Errorf("expected the completed rollout to be forgotten, got %v", autoScaler.rollouts)
+	}
+}
@@ -0,0 +1,269 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	// Time zones are loaded from the binary, since the image has none.
+	_ "time/tzdata"
+
+	"github.com/golang/glog"
+	apiv1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+)
+
+// schedule is a parsed cron schedule: a set of the minutes, hours, days of the
+// month, months and days of the week on which it matches.
+type schedule struct {
+	minute, hour, dom, month, dow uint64
+	// Like cron, when both the day of the month and of the week are
+	// restricted, a day which matches either matches.
+	domRestricted, dowRestricted bool
+}
+
+// parseSchedule parses a standard five field cron schedule.  Each field is a
+// *, or a comma-separated list of numbers or ranges, each optionally with a
+// /step.  Sunday is 0 or 7.
+func parseSchedule(spec string) (*schedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("must have 5 fields (minute hour day-of-month month day-of-week), found %d", len(fields))
+	}
+	s := &schedule{}
+	for _, f := range []struct {
+		name       string
+		min, max   int
+		set        *uint64
+		restricted *bool
+	}{
+		{"minute", 0, 59, &s.minute, nil},
+		{"hour", 0, 23, &s.hour, nil},
+		{"day of month", 1, 31, &s.dom, &s.domRestricted},
+		{"month", 1, 12, &s.month, nil},
+		{"day of week", 0, 7, &s.dow, &s.dowRestricted},
+	} {
+		spec := fields[0]
+		fields = fields[1:]
+		set, err := parseCronField(spec, f.min, f.max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %v", f.name, spec, err)
+		}
+		*f.set = set
+		if f.restricted != nil {
+			*f.restricted = !strings.HasPrefix(spec, "*")
+		}
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+// parseCronField returns the set of values which a field matches.
+func parseCronField(spec string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(spec, ",") {
+		rng, stepSpec, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepSpec)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("step %q must be a positive number", stepSpec)
+			}
+			step = n
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			loSpec, hiSpec, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = strconv.Atoi(loSpec); err != nil {
+				return 0, fmt.Errorf("%q is not a number", loSpec)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(hiSpec); err != nil {
+					return 0, fmt.Errorf("%q is not a number", hiSpec)
+				}
+			} else if hasStep {
+				// Like cron, 5/15 means from 5 to the max in steps of 15.
+				hi = max
+			}
+			if lo < min || hi > max || lo > hi {
+				return 0, fmt.Errorf("%q must be within %d-%d", rng, min, max)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+func (s *schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domRestricted && s.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// next returns the first time after t at which the schedule matches, in the
+// location of t.  It returns false if there is none within five years, as for
+// the 30th of February.
+func (s *schedule) next(t time.Time) (time.Time, bool) {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		y, mon, d := t.Date()
+		switch {
+		case s.month&(1<<uint(mon)) == 0:
+			t = time.Date(y, mon+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			t = time.Date(y, mon, d+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(y, mon, d, t.Hour()+1, 0, 0, 0, loc)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Open returns whether the window is open at a time, and if not, when it next
+// opens.  The zero time means that it never opens.
+func (mw *MaintenanceWindow) Open(now time.Time) (bool, time.Time) {
+	sched, err := parseSchedule(mw.Schedule)
+	if err != nil {
+		glog.Errorf("Invalid maintenance window schedule %q: %v", mw.Schedule, err)
+		return false, time.Time{}
+	}
+	loc, err := time.LoadLocation(mw.TimeZone)
+	if err != nil {
+		glog.Errorf("Invalid maintenance window time zone %q: %v", mw.TimeZone, err)
+		return false, time.Time{}
+	}
+	// The window is open if it last opened less than its duration ago.
+	start, found := sched.next(now.Add(-mw.Duration.Duration).In(loc))
+	if !found {
+		return false, time.Time{}
+	}
+	if !start.After(now) {
+		return true, time.Time{}
+	}
+	return false, start
+}
+
+func (sc ScaleConfig) hasMaintenanceWindows() bool {
+	for _, ctrcfg := range sc {
+		if ctrcfg.MaintenanceWindow != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// HoldOutsideMaintenanceWindows keeps the current resources of each container
+// whose maintenance window is closed, unless the new resources only scale it
+// up and the window allows that.  The current resources are only read if a
+// window is closed.
+//
+// It returns the resources to set, the containers whose new resources are
+// pending, and when the first of their windows opens.
+func HoldOutsideMaintenanceWindows(cfg ScaleConfig, now time.Time, newReqs map[string]apiv1.ResourceRequirements, getCurrent func() (map[string]apiv1.ResourceRequirements, error)) (map[string]apiv1.ResourceRequirements, []string, time.Time, error) {
+	var current map[string]apiv1.ResourceRequirements
+	var reqs map[string]apiv1.ResourceRequirements
+	var pending []string
+	var next time.Time
+	for _, ctr := range sortedNames(newReqs) {
+		window := cfg[ctr].MaintenanceWindow
+		if window == nil {
+			continue
+		}
+		open, opens := window.Open(now)
+		if open {
+			continue
+		}
+		if current == nil {
+			var err error
+			if current, err = getCurrent(); err != nil {
+				return nil, nil, time.Time{}, fmt.Errorf("can't read the current resources: %v", err)
+			}
+		}
+		held := heldResources(current[ctr], newReqs[ctr])
+		if apiequality.Semantic.DeepEqual(held, newReqs[ctr]) || window.AllowScaleUp && isScaleUp(held, newReqs[ctr]) {
+			continue
+		}
+		if reqs == nil {
+			reqs = make(map[string]apiv1.ResourceRequirements, len(newReqs))
+			for c, res := range newReqs {
+				reqs[c] = res
+			}
+		}
+		reqs[ctr] = held
+		pending = append(pending, ctr)
+		if !opens.IsZero() && (next.IsZero() || opens.Before(next)) {
+			next = opens
+		}
+	}
+	if reqs == nil {
+		return newReqs, nil, time.Time{}, nil
+	}
+	return reqs, pending, next, nil
+}
+
+// heldResources returns the current values of the resources which are
+// computed for a container, so that the others are left alone.
+func heldResources(current, newReqs apiv1.ResourceRequirements) apiv1.ResourceRequirements {
+	held := apiv1.ResourceRequirements{
+		Requests: apiv1.ResourceList{},
+		Limits:   apiv1.ResourceList{},
+	}
+	for name := range newReqs.Requests {
+		if q, found := current.Requests[name]; found {
+			held.Requests[name] = q.DeepCopy()
+		}
+	}
+	for name := range newReqs.Limits {
+		if q, found := current.Limits[name]; found {
+			held.Limits[name] = q.DeepCopy()
+		}
+	}
+	return held
+}
+
+// isScaleUp returns whether no new request or limit is below the current one.
+// Setting a limit which was unset lowers it from unlimited.
+func isScaleUp(current, newReqs apiv1.ResourceRequirements) bool {
+	for name, q := range newReqs.Requests {
+		if old, found := current.Requests[name]; found && q.Cmp(old) < 0 {
+			return false
+		}
+	}
+	for name, q := range newReqs.Limits {
+		if old, found := current.Limits[name]; !found || q.Cmp(old) < 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,245 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package autoscaler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	k8sclientapi "github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+	k8sclient "github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient/testing"
+)
+
+func TestParseSchedule(t *testing.T) {
+	for _, tc := range []struct {
+		spec     string
+		expError bool
+	}{
+		{"0 2 * * 1-5", false},
+		{"*/15 0-6,22,23 1,15 */2 0,7", false},
+		{"30 4 1/7 * *", false},
+		{"@daily", true},
+		{"0 2 * *", true},
+		{"60 * * * *", true},
+		{"0 5-2 * * *", true},
+		{"0 * 0 * *", true},
+		{"*/0 * * * *", true},
+		{"0 2 * * mon", true},
+	} {
+		_, err := parseSchedule(tc.spec)
+		if err != nil && !tc.expError {
+			t.Errorf("%q: unexpected error: %v", tc.spec, err)
+		} else if err == nil && tc.expError {
+			t.Errorf("%q: expected error, got none", tc.spec)
+		}
+	}
+}
+
+func TestMaintenanceWindowOpen(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	weekdays := &MaintenanceWindow{Schedule: "0 2 * * 1-5", Duration: metav1.Duration{Duration: 2 * time.Hour}, TimeZone: "Europe/Berlin"}
+	testCases := []struct {
+		name    string
+		window  *MaintenanceWindow
+		now     time.Time
+		expOpen bool
+		expNext time.Time
+	}{
+		{
+			name:    "at the start",
+			window:  weekdays,
+			now:     time.Date(2024, 3, 5, 2, 0, 0, 0, berlin),
+			expOpen: true,
+		},
+		{
+			name:    "before the end",
+			window:  weekdays,
+			now:     time.Date(2024, 3, 5, 3, 59, 0, 0, berlin),
+			expOpen: true,
+		},
+		{
+			name:    "at the end",
+			window:  weekdays,
+			now:     time.Date(2024, 3, 5, 4, 0, 0, 0, berlin),
+			expNext: time.Date(2024, 3, 6, 2, 0, 0, 0, berlin),
+		},
+		{
+			name:    "in another time zone",
+			window:  weekdays,
+			now:     time.Date(2024, 3, 5, 1, 30, 0, 0, time.UTC),
+			expOpen: true,
+		},
+		{
+			name:    "at the weekend",
+			window:  weekdays,
+			now:     time.Date(2024, 3, 9, 2, 30, 0, 0, berlin),
+			expNext: time.Date(2024, 3, 11, 2, 0, 0, 0, berlin),
+		},
+		{
+			name:    "spanning midnight",
+			window:  &MaintenanceWindow{Schedule: "0 22 * * *", Duration: metav1.Duration{Duration: 4 * time.Hour}},
+			now:     time.Date(2024, 3, 6, 1, 0, 0, 0, time.UTC),
+			expOpen: true,
+		},
+		{
+			name:    "day of month or week",
+			window:  &MaintenanceWindow{Schedule: "0 0 1 * 0", Duration: metav1.Duration{Duration: time.Hour}},
+			now:     time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC),
+			expNext: time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "never",
+			window: &MaintenanceWindow{Schedule: "0 0 30 2 *", Duration: metav1.Duration{Duration: time.Hour}},
+			now:    time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tc := range testCases {
+		open, next := tc.window.Open(tc.now)
+		if open != tc.expOpen || !next.Equal(tc.expNext) {
+			t.Errorf("%s: expected open %t and next %v, got %t and %v", tc.name, tc.expOpen, tc.expNext, open, next)
+		}
+	}
+}
+
+func TestHoldOutsideMaintenanceWindows(t *testing.T) {
+	closed := &MaintenanceWindow{Schedule: "0 2 * * *", Duration: metav1.Duration{Duration: time.Hour}}
+	now := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	current := map[string]apiv1.ResourceRequirements{
+		"thing": {
+			Requests: resourceList("cpu", "1", "memory", "100Mi"),
+			Limits:   resourceList("memory", "200Mi"),
+		},
+	}
+	getCurrent := func() (map[string]apiv1.ResourceRequirements, error) { return current, nil }
+
+	testCases := []struct {
+		name       string
+		window     *MaintenanceWindow
+		newReqs    apiv1.ResourceRequirements
+		expReqs    apiv1.ResourceRequirements
+		expPending bool
+	}{
+		{
+			name:    "no window",
+			newReqs: apiv1.ResourceRequirements{Requests: resourceList("cpu", "500m")},
+			expReqs: apiv1.ResourceRequirements{Requests: resourceList("cpu", "500m")},
+		},
+		{
+			name:       "held",
+			window:     closed,
+			newReqs:    apiv1.ResourceRequirements{Requests: resourceList("cpu", "2", "ephemeral-storage", "1Gi"), Limits: resourceList()},
+			expReqs:    apiv1.ResourceRequirements{Requests: resourceList("cpu", "1"), Limits: resourceList()},
+			expPending: true,
+		},
+		{
+			name:    "unchanged",
+			window:  closed,
+			newReqs: apiv1.ResourceRequirements{Requests: resourceList("cpu", "1"), Limits: resourceList("memory", "200Mi")},
+			expReqs: apiv1.ResourceRequirements{Requests: resourceList("cpu", "1"), Limits: resourceList("memory", "200Mi")},
+		},
+		{
+			name:    "scale up allowed",
+			window:  &MaintenanceWindow{Schedule: closed.Schedule, Duration: closed.Duration, AllowScaleUp: true},
+			newReqs: apiv1.ResourceRequirements{Requests: resourceList("cpu", "2"), Limits: resourceList("memory", "300Mi")},
+			expReqs: apiv1.ResourceRequirements{Requests: resourceList("cpu", "2"), Limits: resourceList("memory", "300Mi")},
+		},
+		{
+			name:       "scale down held",
+			window:     &MaintenanceWindow{Schedule: closed.Schedule, Duration: closed.Duration, AllowScaleUp: true},
+			newReqs:    apiv1.ResourceRequirements{Requests: resourceList("cpu", "2", "memory", "50Mi"), Limits: resourceList()},
+			expReqs:    apiv1.ResourceRequirements{Requests: resourceList("cpu", "1", "memory", "100Mi"), Limits: resourceList()},
+			expPending: true,
+		},
+		{
+			name:       "new limit held",
+			window:     &MaintenanceWindow{Schedule: closed.Schedule, Duration: closed.Duration, AllowScaleUp: true},
+			newReqs:    apiv1.ResourceRequirements{Requests: resourceList(), Limits: resourceList("cpu", "2")},
+			expReqs:    apiv1.ResourceRequirements{Requests: resourceList(), Limits: resourceList()},
+			expPending: true,
+		},
+	}
+	for _, tc := range testCases {
+		cfg := ScaleConfig{"thing": ContainerScaleConfig{MaintenanceWindow: tc.window}}
+		newReqs := map[string]apiv1.ResourceRequirements{"thing": tc.newReqs}
+		reqs, pending, next, err := HoldOutsideMaintenanceWindows(cfg, now, newReqs, getCurrent)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if !apiequality.Semantic.DeepEqual(reqs["thing"], tc.expReqs) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expReqs, reqs["thing"])
+		}
+		if tc.expPending {
+			if exp := []string{"thing"}; !reflect.DeepEqual(pending, exp) {
+				t.Errorf("%s: expected %v to be pending, got %v", tc.name, exp, pending)
+			}
+			if exp := time.Date(2024, 3, 6, 2, 0, 0, 0, time.UTC); !next.Equal(exp) {
+				t.Errorf("%s: expected the window to open at %v, got %v", tc.name, exp, next)
+			}
+		} else if len(pending) > 0 {
+			t.Errorf("%s: expected nothing to be pending, got %v", tc.name, pending)
+		}
+	}
+}
+
+func TestPollAPIServerMaintenanceWindow(t *testing.T) {
+	cfg := ScaleConfig{}
+	if err := ParseScaleConfig([]byte(`{"thing":{"requests":{"cpu":{"base":"1","step":"1","nodesPerStep":1}},"maintenanceWindow":{"schedule":"0 2 * * *","duration":"1h"}}}`), &cfg); err != nil {
+		t.Fatalf("invalid default config: %v", err)
+	}
+	tgt := k8sclientapi.Target{Kind: "Deployment", Namespace: "default", Name: "thing"}
+	mockK8s := &k8sclient.MockK8sClient{
+		NumOfNodes: 4,
+		NumOfCores: 8,
+		Targets:    []k8sclientapi.Target{tgt},
+		Resources: map[k8sclientapi.Target]map[string]apiv1.ResourceRequirements{
+			tgt: {"thing": {Requests: resourceList("cpu", "3")}},
+		},
+	}
+	fakeClock := clocktesting.NewFakeClock(time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC))
+	autoScaler := &AutoScaler{
+		k8sClient:     mockK8s,
+		defaultConfig: cfg,
+		clock:         fakeClock,
+	}
+
+	// The new resources are pending until the window opens, and reported
+	// once.
+	autoScaler.pollAPIServer()
+	autoScaler.pollAPIServer()
+	if q := mockK8s.Updates[tgt]["thing"].Requests[apiv1.ResourceCPU]; q.String() != "3" {
+		t.Errorf("expected cpu to be held at 3, got %s", &q)
+	}
+	if exp := []string{"UpdatePending"}; !reflect.DeepEqual(mockK8s.Events[tgt], exp) {
+		t.Errorf("expected events %v, got %v", exp, mockK8s.Events[tgt])
+	}
+
+	fakeClock.SetTime(time.Date(2024, 3, 6, 2, 30, 0, 0, time.UTC))
+	autoScaler.pollAPIServer()
+	if q := mockK8s.Updates[tgt]["thing"].Requests[apiv1.ResourceCPU]; q.String() != "5" {
+		t.Errorf("expected cpu to be updated to 5 in the window, got %s", &q)
+	}
+}
@@ -0,0 +1,265 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package controller implements the reconciliation of ProportionalVerticalScaler
+// objects, each of which scales one target with its own config.
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	apiv1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/utils/clock"
+
+	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/cmd/cpvpa/options"
+	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/apis/cpvpa/v1alpha1"
+	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/autoscaler"
+	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+)
+
+// Controller reconciles ProportionalVerticalScaler objects in all namespaces.
+type Controller struct {
+	k8sClient  k8sclient.K8sClient
+	client     dynamic.Interface
+	dryRun     bool
+	pollPeriod time.Duration
+	clock      clock.WithTicker
+	stopCh     chan struct{}
+
+	// How resources which conflict with the namespace of a target are
+	// handled.
+	namespacePolicy string
+}
+
+// NewController returns a new Controller
+func NewController(c *options.AutoScalerConfig) (*Controller, error) {
+	newK8sClient, err := k8sclient.NewK8sClient(c.K8sClientOptions())
+	if err != nil {
+		return nil, err
+	}
+	config, err := k8sclient.BuildConfig(c.Kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &Controller{
+		k8sClient:  newK8sClient,
+		client:     client,
+		dryRun:     c.DryRun,
+		pollPeriod: time.Second * time.Duration(c.PollPeriodSeconds),
+		clock:      clock.RealClock{},
+		stopCh:     make(chan struct{}),
+
+		namespacePolicy: c.NamespacePolicy,
+	}, nil
+}
+
+// Run periodically counts the number of nodes and cores, and reconciles every
+// ProportionalVerticalScaler against them.
+func (c *Controller) Run() {
+	ticker := c.clock.NewTicker(c.pollPeriod)
+
+	// Don't wait for ticker and execute reconcileAll() for the first time.
+	c.reconcileAll()
+
+	for {
+		select {
+		case <-ticker.C():
+			c.reconcileAll()
+		case <-c.stopCh:
+			return
+		}
+	}
+}
+
+func (c *Controller) reconcileAll() {
+	clusterSize, err := c.k8sClient.GetClusterSize()
+	if err != nil {
+		glog.Errorf("Error getting cluster size: %v", err)
+		return
+	}
+	glog.V(4).Infof("Nodes %5d", clusterSize.Nodes)
+	glog.V(4).Infof("Cores %5d", clusterSize.Cores)
+
+	list, err := c.client.Resource(v1alpha1.Resource).Namespace(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		glog.Errorf("Error listing %s: %v", v1alpha1.Resource.Resource, err)
+		return
+	}
+	for i := range list.Items {
+		item := &list.Items[i]
+		pvs := &v1alpha1.ProportionalVerticalScaler{}
+		if err := convert(item.Object, pvs); err != nil {
+			glog.Errorf("Failed to decode %s/%s: %v", item.GetNamespace(), item.GetName(), err)
+			continue
+		}
+
+		status := c.reconcile(pvs, clusterSize)
+		if apiequality.Semantic.DeepEqual(status, pvs.Status) {
+			continue
+		}
+		if err := c.updateStatus(item, status); err != nil {
+			glog.Errorf("Failed to update status of %s/%s: %v", pvs.Namespace, pvs.Name, err)
+		}
+	}
+}
+
+// reconcile applies the resources computed for the cluster size to the target
+// of a scaler, and returns its new status.
+func (c *Controller) reconcile(pvs *v1alpha1.ProportionalVerticalScaler, clusterSize *k8sclient.ClusterSize) v1alpha1.ProportionalVerticalScalerStatus {
+	status := pvs.Status
+	status.Conditions = append([]metav1.Condition(nil), pvs.Status.Conditions...)
+	status.ObservedGeneration = pvs.Generation
+	status.ClusterSize = &v1alpha1.ClusterSize{Nodes: clusterSize.Nodes, Cores: clusterSize.Cores}
+	setReady := func(ready metav1.ConditionStatus, reason, message string) {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               v1alpha1.ConditionReady,
+			Status:             ready,
+			ObservedGeneration: pvs.Generation,
+			Reason:             reason,
+			Message:            message,
+		})
+	}
+
+	ref := pvs.Spec.TargetRef
+	switch ref.Kind {
+	case "Deployment", "DaemonSet", "ReplicaSet":
+	default:
+		setReady(metav1.ConditionFalse, v1alpha1.ReasonInvalidTarget,
+			fmt.Sprintf("unsupported target kind %q: must be one of Deployment, DaemonSet or ReplicaSet", ref.Kind))
+		return status
+	}
+	// The target is patched through whichever version the apiserver serves,
+	// but a ref to a group which does not serve the kind is a mistake.
+	if ref.APIVersion != "" && !k8sclient.SupportsAPIVersion(ref.Kind, ref.APIVersion) {
+		setReady(metav1.ConditionFalse, v1alpha1.ReasonInvalidTarget,
+			fmt.Sprintf("unsupported apiVersion %q for target kind %s: must be a group-version which serves the kind, such as apps/v1", ref.APIVersion, ref.Kind))
+		return status
+	}
+	target := k8sclient.Target{Kind: ref.Kind, Namespace: pvs.Namespace, Name: ref.Name}
+	if errs := autoscaler.ValidateScaleConfig(pvs.Spec.Containers, field.NewPath("spec", "containers")); len(errs) > 0 {
+		setReady(metav1.ConditionFalse, v1alpha1.ReasonInvalidConfig, errs.ToAggregate().Error())
+		return status
+	}
+
+	newReqs, err := autoscaler.ComputeRequirements(pvs.Spec.Containers, clusterSize)
+	if err != nil {
+		glog.Errorf("Failed to compute resources of %s for %s/%s: %v", target, pvs.Namespace, pvs.Name, err)
+		setReady(metav1.ConditionFalse, v1alpha1.ReasonCalculationFailed, err.Error())
+		return status
+	}
+	status.DesiredResources = newReqs
+	if pvs.Spec.Behavior != nil && pvs.Spec.Behavior.UpdateMode == v1alpha1.UpdateModeOff {
+		setReady(metav1.ConditionFalse, v1alpha1.ReasonUpdateDisabled, "updateMode is Off, so resources are not applied")
+		return status
+	}
+	// The namespace policy is read on every reconcile, so a change to it
+	// applies even if the cluster size does not change.
+	var clamped []string
+	if c.namespacePolicy != "" && c.namespacePolicy != options.NamespacePolicyIgnore {
+		policy, err := c.k8sClient.GetResourcePolicy(target)
+		if err != nil {
+			glog.Errorf("Failed to read the namespace policy of %s for %s/%s: %v", target, pvs.Namespace, pvs.Name, err)
+			setReady(metav1.ConditionFalse, v1alpha1.ReasonUpdateFailed, err.Error())
+			return status
+		}
+		newReqs, clamped, err = autoscaler.EnforceNamespacePolicy(c.namespacePolicy, policy, newReqs)
+		if err != nil {
+			glog.Errorf("Not updating %s for %s/%s, which would conflict with its namespace policy: %v", target, pvs.Namespace, pvs.Name, err)
+			setReady(metav1.ConditionFalse, v1alpha1.ReasonNamespacePolicyConflict, err.Error())
+			return status
+		}
+	}
+	newReqs, pending, next, err := autoscaler.HoldOutsideMaintenanceWindows(pvs.Spec.Containers, c.clock.Now(), newReqs, func() (map[string]apiv1.ResourceRequirements, error) {
+		return c.k8sClient.GetResources(target)
+	})
+	if err != nil {
+		glog.Errorf("Not updating %s for %s/%s: %v", target, pvs.Namespace, pvs.Name, err)
+		setReady(metav1.ConditionFalse, v1alpha1.ReasonUpdateFailed, err.Error())
+		return status
+	}
+	ready := func() {
+		if len(pending) > 0 {
+			message := fmt.Sprintf("resources of %s are held until the maintenance window opens", strings.Join(pending, ", "))
+			if !next.IsZero() {
+				message = fmt.Sprintf("%s at %s", message, next.Format(time.RFC3339))
+			}
+			setReady(metav1.ConditionTrue, v1alpha1.ReasonUpdatePending, message)
+			return
+		}
+		if len(clamped) > 0 {
+			setReady(metav1.ConditionTrue, v1alpha1.ReasonResourcesClamped, strings.Join(clamped, "; "))
+			return
+		}
+		setReady(metav1.ConditionTrue, v1alpha1.ReasonResourcesApplied, "")
+	}
+	if apiequality.Semantic.DeepEqual(status.LastAppliedResources, newReqs) {
+		ready()
+		return status
+	}
+
+	glog.V(0).Infof("Updating resource of %s for %s/%s, nodes: %d, cores: %d",
+		target, pvs.Namespace, pvs.Name, clusterSize.Nodes, clusterSize.Cores)
+	if err := c.k8sClient.UpdateResources(target, newReqs); err != nil {
+		glog.Errorf("Update failure for %s: %s", target, err)
+		setReady(metav1.ConditionFalse, v1alpha1.ReasonUpdateFailed, err.Error())
+		return status
+	}
+	now := metav1.NewTime(c.clock.Now())
+	status.LastAppliedResources = newReqs
+	status.LastUpdateTime = &now
+	ready()
+	return status
+}
+
+func (c *Controller) updateStatus(item *unstructured.Unstructured, status v1alpha1.ProportionalVerticalScalerStatus) error {
+	obj := map[string]interface{}{}
+	if err := convert(status, &obj); err != nil {
+		return err
+	}
+	if c.dryRun {
+		glog.Infof("Performing dry-run, not updating status of %s/%s to %v", item.GetNamespace(), item.GetName(), obj)
+		return nil
+	}
+	item = item.DeepCopy()
+	item.Object["status"] = obj
+	_, err := c.client.Resource(v1alpha1.Resource).Namespace(item.GetNamespace()).UpdateStatus(context.TODO(), item, metav1.UpdateOptions{})
+	return err
+}
+
+// convert copies between unstructured and typed objects.  It goes through
+// JSON, because the config types rely on its case-insensitive field names.
+func convert(in, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,272 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/cmd/cpvpa/options"
+	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/apis/cpvpa/v1alpha1"
+	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+	k8sclienttesting "github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient/testing"
+)
+
+func newScaler(name, kind, updateMode string) *unstructured.Unstructured {
+	spec := map[string]interface{}{
+		"targetRef": map[string]interface{}{"apiVersion": "apps/v1", "kind": kind, "name": name},
+		"containers": map[string]interface{}{
+			name: map[string]interface{}{
+				"requests": map[string]interface{}{
+					"cpu": map[string]interface{}{"base": "10m", "step": "1m", "nodesPerStep": int64(1)},
+				},
+			},
+		},
+	}
+	if updateMode != "" {
+		spec["behavior"] = map[string]interface{}{"updateMode": updateMode}
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": v1alpha1.SchemeGroupVersion.String(),
+		"kind":       "ProportionalVerticalScaler",
+		"metadata": map[string]interface{}{
+			"namespace":  "default",
+			"name":       name,
+			"generation": int64(2),
+		},
+		"spec": spec,
+	}}
+}
+
+func getStatus(t *testing.T, ctrl *Controller, name string) v1alpha1.ProportionalVerticalScalerStatus {
+	item, err := ctrl.client.Resource(v1alpha1.Resource).Namespace("default").Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get %s: %v", name, err)
+	}
+	pvs := &v1alpha1.ProportionalVerticalScaler{}
+	if err := convert(item.Object, pvs); err != nil {
+		t.Fatalf("failed to decode %s: %v", name, err)
+	}
+	return pvs.Status
+}
+
+func TestReconcileAll(t *testing.T) {
+	mockK8s := &k8sclienttesting.MockK8sClient{
+		NumOfNodes: 4,
+		NumOfCores: 8,
+	}
+	invalid := newScaler("invalid", "Deployment", "")
+	if err := unstructured.SetNestedField(invalid.Object, "-1", "spec", "containers", "invalid", "requests", "cpu", "base"); err != nil {
+		t.Fatal(err)
+	}
+	wrongGroup := newScaler("wrong-group", "Deployment", "")
+	if err := unstructured.SetNestedField(wrongGroup.Object, "batch/v1", "spec", "targetRef", "apiVersion"); err != nil {
+		t.Fatal(err)
+	}
+	overflow := newScaler("overflow", "Deployment", "")
+	if err := unstructured.SetNestedField(overflow.Object, "9P", "spec", "containers", "overflow", "requests", "cpu", "step"); err != nil {
+		t.Fatal(err)
+	}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{v1alpha1.Resource: "ProportionalVerticalScalerList"},
+		newScaler("auto", "Deployment", ""),
+		newScaler("off", "DaemonSet", "Off"),
+		newScaler("bad", "StatefulSet", ""),
+		invalid,
+		wrongGroup,
+		overflow,
+	)
+	ctrl := &Controller{
+		k8sClient: mockK8s,
+		client:    client,
+		clock:     clocktesting.NewFakeClock(time.Now()),
+	}
+
+	ctrl.reconcileAll()
+
+	auto := k8sclient.Target{Kind: "Deployment", Namespace: "default", Name: "auto"}
+	got := mockK8s.Updates[auto]["auto"].Requests[apiv1.ResourceCPU]
+	if got.MilliValue() != 14 {
+		t.Errorf("expected cpu request of 14m, got %v", &got)
+	}
+	if len(mockK8s.Updates) != 1 {
+		t.Errorf("expected only %s to be updated, got %v", auto, mockK8s.Updates)
+	}
+
+	for _, tc := range []struct {
+		name      string
+		expReady  metav1.ConditionStatus
+		expReason string
+		expApply  bool
+	}{
+		{"auto", metav1.ConditionTrue, v1alpha1.ReasonResourcesApplied, true},
+		{"off", metav1.ConditionFalse, v1alpha1.ReasonUpdateDisabled, false},
+		{"bad", metav1.ConditionFalse, v1alpha1.ReasonInvalidTarget, false},
+		{"wrong-group", metav1.ConditionFalse, v1alpha1.ReasonInvalidTarget, false},
+		{"invalid", metav1.ConditionFalse, v1alpha1.ReasonInvalidConfig, false},
+		{"overflow", metav1.ConditionFalse, v1alpha1.ReasonCalculationFailed, false},
+	} {
+		status := getStatus(t, ctrl, tc.name)
+		if status.ObservedGeneration != 2 {
+			t.Errorf("%s: expected observedGeneration 2, got %d", tc.name, status.ObservedGeneration)
+		}
+		if status.ClusterSize == nil || *status.ClusterSize != (v1alpha1.ClusterSize{Nodes: 4, Cores: 8}) {
+			t.Errorf("%s: expected cluster size of 4 nodes and 8 cores, got %v", tc.name, status.ClusterSize)
+		}
+		ready := meta.FindStatusCondition(status.Conditions, v1alpha1.ConditionReady)
+		if ready == nil || ready.Status != tc.expReady || ready.Reason != tc.expReason {
+			t.Errorf("%s: expected Ready=%s with reason %s, got %v", tc.name, tc.expReady, tc.expReason, ready)
+		}
+		if applied := status.LastAppliedResources != nil; applied != tc.expApply {
+			t.Errorf("%s: expected resources applied to be %t, got %v", tc.name, tc.expApply, status.LastAppliedResources)
+		}
+	}
+	offStatus := getStatus(t, ctrl, "off")
+	if cpu := offStatus.DesiredResources["off"].Requests[apiv1.ResourceCPU]; cpu.MilliValue() != 14 {
+		t.Errorf("off: expected desired cpu request of 14m, got %v", &cpu)
+	}
+
+	// Once applied, the recorded status stops the target from being patched
+	// again.
+	mockK8s.Updates = nil
+	ctrl.reconcileAll()
+	if len(mockK8s.Updates) != 0 {
+		t.Errorf("expected no updates, got %v", mockK8s.Updates)
+	}
+}
+
+func TestReconcileNamespacePolicy(t *testing.T) {
+	clamped := k8sclient.Target{Kind: "Deployment", Namespace: "default", Name: "clamped"}
+	conflict := k8sclient.Target{Kind: "Deployment", Namespace: "default", Name: "conflict"}
+	mockK8s := &k8sclienttesting.MockK8sClient{
+		NumOfNodes: 4,
+		NumOfCores: 8,
+		Policies: map[k8sclient.Target]*k8sclient.ResourcePolicy{
+			clamped: {
+				LimitRanges: []apiv1.LimitRange{{
+					ObjectMeta: metav1.ObjectMeta{Name: "limits"},
+					Spec: apiv1.LimitRangeSpec{Limits: []apiv1.LimitRangeItem{{
+						Type: apiv1.LimitTypeContainer,
+						Max:  apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("12m")},
+					}}},
+				}},
+				Pods: 1,
+			},
+			conflict: {
+				ResourceQuotas: []apiv1.ResourceQuota{{
+					ObjectMeta: metav1.ObjectMeta{Name: "quota"},
+					Spec:       apiv1.ResourceQuotaSpec{Hard: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("20m")}},
+					Status:     apiv1.ResourceQuotaStatus{Used: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("10m")}},
+				}},
+				Pods: 1,
+			},
+		},
+	}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{v1alpha1.Resource: "ProportionalVerticalScalerList"},
+		newScaler("clamped", "Deployment", ""),
+		newScaler("conflict", "Deployment", ""),
+	)
+	ctrl := &Controller{
+		k8sClient:       mockK8s,
+		client:          client,
+		clock:           clocktesting.NewFakeClock(time.Now()),
+		namespacePolicy: options.NamespacePolicyClamp,
+	}
+
+	ctrl.reconcileAll()
+
+	got := mockK8s.Updates[clamped]["clamped"].Requests[apiv1.ResourceCPU]
+	if got.MilliValue() != 12 {
+		t.Errorf("expected cpu request to be clamped to 12m, got %v", &got)
+	}
+	if _, found := mockK8s.Updates[conflict]; found {
+		t.Errorf("expected %s not to be updated", conflict)
+	}
+	for _, tc := range []struct {
+		name      string
+		expReady  metav1.ConditionStatus
+		expReason string
+	}{
+		{"clamped", metav1.ConditionTrue, v1alpha1.ReasonResourcesClamped},
+		{"conflict", metav1.ConditionFalse, v1alpha1.ReasonNamespacePolicyConflict},
+	} {
+		ready := meta.FindStatusCondition(getStatus(t, ctrl, tc.name).Conditions, v1alpha1.ConditionReady)
+		if ready == nil || ready.Status != tc.expReady || ready.Reason != tc.expReason {
+			t.Errorf("%s: expected Ready=%s with reason %s, got %v", tc.name, tc.expReady, tc.expReason, ready)
+		}
+	}
+
+	// The clamped resources were applied, so they are not patched again.
+	mockK8s.Updates = nil
+	ctrl.reconcileAll()
+	if len(mockK8s.Updates) != 0 {
+		t.Errorf("expected no updates, got %v", mockK8s.Updates)
+	}
+}
+
+func TestReconcileMaintenanceWindow(t *testing.T) {
+	target := k8sclient.Target{Kind: "Deployment", Namespace: "default", Name: "held"}
+	mockK8s := &k8sclienttesting.MockK8sClient{
+		NumOfNodes: 4,
+		NumOfCores: 8,
+		Resources: map[k8sclient.Target]map[string]apiv1.ResourceRequirements{
+			target: {"held": {Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("10m")}}},
+		},
+	}
+	scaler := newScaler("held", "Deployment", "")
+	window := map[string]interface{}{"schedule": "0 2 * * *", "duration": "1h"}
+	if err := unstructured.SetNestedField(scaler.Object, window, "spec", "containers", "held", "maintenanceWindow"); err != nil {
+		t.Fatal(err)
+	}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{v1alpha1.Resource: "ProportionalVerticalScalerList"},
+		scaler,
+	)
+	ctrl := &Controller{
+		k8sClient: mockK8s,
+		client:    client,
+		clock:     clocktesting.NewFakeClock(time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)),
+	}
+
+	ctrl.reconcileAll()
+
+	got := mockK8s.Updates[target]["held"].Requests[apiv1.ResourceCPU]
+	if got.MilliValue() != 10 {
+		t.Errorf("expected cpu request to be held at 10m, got %v", &got)
+	}
+	status := getStatus(t, ctrl, "held")
+	desired := status.DesiredResources["held"].Requests[apiv1.ResourceCPU]
+	if desired.MilliValue() != 14 {
+		t.Errorf("expected the desired cpu request to be 14m, got %v", &desired)
+	}
+	ready := meta.FindStatusCondition(status.Conditions, v1alpha1.ConditionReady)
+	if ready == nil || ready.Reason != v1alpha1.ReasonUpdatePending {
+		t.Errorf("expected Ready with reason %s, got %v", v1alpha1.ReasonUpdatePending, ready)
+	}
+}
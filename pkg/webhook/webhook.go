@@ -0,0 +1,251 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package webhook implements a mutating admission webhook which sets the
+// resources of each DaemonSet pod from the size of the node it is scheduled
+// to, rather than from the size of the whole cluster.
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/golang/glog"
+	admissionv1 "k8s.io/api/admission/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/cmd/cpvpa/options"
+	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/autoscaler"
+	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/autoscaler/k8sclient"
+)
+
+// MutatePath is the path which AdmissionReviews are posted to.
+const MutatePath = "/mutate"
+
+// maxReviewSize is the largest AdmissionReview which is read.  The apiserver
+// limits objects to a few megabytes.
+const maxReviewSize = 8 << 20
+
+// Server mutates DaemonSet pods at admission.
+type Server struct {
+	clientset kubernetes.Interface
+	config    *autoscaler.FileConfig
+}
+
+// NewServer returns a new Server
+func NewServer(c *options.AutoScalerConfig) (*Server, error) {
+	config, err := k8sclient.BuildConfig(c.Kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	configPaths := c.ConfigFiles
+	if c.ConfigOverlay != "" {
+		configPaths = append(append([]string{}, configPaths...), c.ConfigOverlay)
+	}
+	// The config files are watched, so that a change applies to the next pod
+	// without reading them for each one.  This fails fast on a config which
+	// never loads.
+	fileConfig, err := autoscaler.NewFileConfig(c.DefaultConfig, configPaths, wait.NeverStop)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{clientset: clientset, config: fileConfig}, nil
+}
+
+// Run serves the webhook over TLS until it fails.
+func (s *Server) Run(address, certFile, keyFile string) error {
+	mux := http.NewServeMux()
+	mux.Handle(MutatePath, s)
+	glog.V(0).Infof("Serving admission webhook on %s%s", address, MutatePath)
+	return http.ListenAndServeTLS(address, certFile, keyFile, mux)
+}
+
+// ServeHTTP answers an AdmissionReview.  Pods are always admitted: a pod which
+// can't be sized keeps the resources of its template.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxReviewSize))
+	if err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	review := &admissionv1.AdmissionReview{}
+	if err := json.Unmarshal(body, review); err != nil || review.Request == nil {
+		http.Error(w, fmt.Sprintf("invalid AdmissionReview: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	response := &admissionv1.AdmissionResponse{UID: review.Request.UID, Allowed: true}
+	patch, err := s.mutate(review.Request)
+	if err != nil {
+		glog.Errorf("Failed to set resources of pod %s/%s: %v", review.Request.Namespace, podName(review.Request), err)
+		response.Warnings = []string{fmt.Sprintf("cpvpa did not set resources: %v", err)}
+	} else if patch != nil {
+		patchType := admissionv1.PatchTypeJSONPatch
+		response.Patch = patch
+		response.PatchType = &patchType
+	}
+	review.Response = response
+	review.Request = nil
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(review); err != nil {
+		glog.Errorf("Failed to write AdmissionReview response: %v", err)
+	}
+}
+
+// mutate returns a JSON patch which sets the resources of a DaemonSet pod, or
+// nil if the pod is left alone.
+func (s *Server) mutate(req *admissionv1.AdmissionRequest) ([]byte, error) {
+	if req.Kind.Kind != "Pod" || req.Operation != admissionv1.Create {
+		return nil, nil
+	}
+	pod := &apiv1.Pod{}
+	if err := json.Unmarshal(req.Object.Raw, pod); err != nil {
+		return nil, fmt.Errorf("failed to decode pod: %v", err)
+	}
+	if !ownedByDaemonSet(pod) {
+		return nil, nil
+	}
+	nodeName := scheduledNode(pod)
+	if nodeName == "" {
+		return nil, fmt.Errorf("pod is not scheduled to a node")
+	}
+	node, err := s.clientset.CoreV1().Nodes().Get(context.TODO(), nodeName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node %s: %v", nodeName, err)
+	}
+
+	cfg := s.config.Get()
+	// The node is a cluster of its own, so nodesPerStep always counts one.
+	cores := node.Status.Capacity[apiv1.ResourceCPU]
+	memory := node.Status.Capacity[apiv1.ResourceMemory]
+	nodeSize := &k8sclient.ClusterSize{
+		Nodes:  1,
+		Cores:  int(cores.MilliValue() / 1000),
+		Memory: memory.Value(),
+		NodeSizes: []k8sclient.NodeSize{{
+			Labels:      node.Labels,
+			MilliCores:  cores.MilliValue(),
+			Memory:      memory.Value(),
+			Allocatable: node.Status.Allocatable,
+		}},
+	}
+	newReqs, err := autoscaler.ComputeRequirements(cfg, nodeSize)
+	if err != nil {
+		return nil, err
+	}
+	return resourcesPatch(pod, newReqs, nodeName)
+}
+
+type patchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// resourcesPatch sets the computed resources over those of each container of
+// the pod, leaving any others alone.
+func resourcesPatch(pod *apiv1.Pod, newReqs map[string]apiv1.ResourceRequirements, nodeName string) ([]byte, error) {
+	ops := []patchOperation{}
+	for i, ctr := range pod.Spec.Containers {
+		reqs, found := newReqs[ctr.Name]
+		if !found {
+			continue
+		}
+		resources := *ctr.Resources.DeepCopy()
+		if len(reqs.Requests) > 0 && resources.Requests == nil {
+			resources.Requests = apiv1.ResourceList{}
+		}
+		for name, q := range reqs.Requests {
+			resources.Requests[name] = q
+		}
+		if len(reqs.Limits) > 0 && resources.Limits == nil {
+			resources.Limits = apiv1.ResourceList{}
+		}
+		for name, q := range reqs.Limits {
+			resources.Limits[name] = q
+		}
+		glog.V(2).Infof("Setting %s resources of pod %s/%s on node %s: %v", ctr.Name, pod.Namespace, pod.GenerateName, nodeName, resources)
+		// Adding an existing member replaces it.
+		ops = append(ops, patchOperation{
+			Op:    "add",
+			Path:  fmt.Sprintf("/spec/containers/%d/resources", i),
+			Value: resources,
+		})
+	}
+	if len(ops) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(ops)
+}
+
+func ownedByDaemonSet(pod *apiv1.Pod) bool {
+	for _, ref := range pod.OwnerReferences {
+		if ref.Kind == "DaemonSet" && ref.Controller != nil && *ref.Controller {
+			return true
+		}
+	}
+	return false
+}
+
+// scheduledNode returns the node of a pod.  DaemonSet pods are created with a
+// required node affinity for their node, which the scheduler later binds them
+// to, rather than with a nodeName.
+func scheduledNode(pod *apiv1.Pod) string {
+	if pod.Spec.NodeName != "" {
+		return pod.Spec.NodeName
+	}
+	affinity := pod.Spec.Affinity
+	if affinity == nil || affinity.NodeAffinity == nil || affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return ""
+	}
+	for _, term := range affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		for _, req := range term.MatchFields {
+			if req.Key == metav1.ObjectNameField && req.Operator == apiv1.NodeSelectorOpIn && len(req.Values) == 1 {
+				return req.Values[0]
+			}
+		}
+	}
+	return ""
+}
+
+// podName returns the name of a pod, which is usually only generated after
+// admission.
+func podName(req *admissionv1.AdmissionRequest) string {
+	if req.Name != "" {
+		return req.Name
+	}
+	pod := &apiv1.Pod{}
+	if err := json.Unmarshal(req.Object.Raw, pod); err == nil && pod.GenerateName != "" {
+		return pod.GenerateName + "*"
+	}
+	return "<unknown>"
+}
@@ -0,0 +1,204 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/kubernetes-sigs/cluster-proportional-vertical-autoscaler/pkg/autoscaler"
+)
+
+const testConfig = `{"agent":{"requests":{"cpu":{"base":"100m","step":"50m","coresPerStep":4},"memory":{"base":"100Mi","step":"10Mi","memoryPerStep":"4Gi"}}}}`
+
+func testNode(name, cpu, memory string) *apiv1.Node {
+	return &apiv1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: apiv1.NodeStatus{
+			Capacity: apiv1.ResourceList{
+				apiv1.ResourceCPU:    resource.MustParse(cpu),
+				apiv1.ResourceMemory: resource.MustParse(memory),
+			},
+		},
+	}
+}
+
+func testPod(owner, nodeName string) *apiv1.Pod {
+	controller := true
+	pod := &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "agent-",
+			Namespace:    "kube-system",
+		},
+		Spec: apiv1.PodSpec{
+			Containers: []apiv1.Container{
+				{Name: "sidecar"},
+				{
+					Name: "agent",
+					Resources: apiv1.ResourceRequirements{
+						Requests: apiv1.ResourceList{apiv1.ResourceCPU: resource.MustParse("1")},
+						Limits:   apiv1.ResourceList{apiv1.ResourceMemory: resource.MustParse("1Gi")},
+					},
+				},
+			},
+			Affinity: &apiv1.Affinity{
+				NodeAffinity: &apiv1.NodeAffinity{
+					RequiredDuringSchedulingIgnoredDuringExecution: &apiv1.NodeSelector{
+						NodeSelectorTerms: []apiv1.NodeSelectorTerm{{
+							MatchFields: []apiv1.NodeSelectorRequirement{{
+								Key:      metav1.ObjectNameField,
+								Operator: apiv1.NodeSelectorOpIn,
+								Values:   []string{nodeName},
+							}},
+						}},
+					},
+				},
+			},
+		},
+	}
+	if owner != "" {
+		pod.OwnerReferences = []metav1.OwnerReference{{Kind: owner, Name: "agent", Controller: &controller}}
+	}
+	return pod
+}
+
+func review(t *testing.T, s *Server, pod *apiv1.Pod) *admissionv1.AdmissionResponse {
+	raw, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := json.Marshal(&admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+		Request: &admissionv1.AdmissionRequest{
+			UID:       "uid",
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Namespace: pod.Namespace,
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("POST", MutatePath, bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+	resp := &admissionv1.AdmissionReview{}
+	if err := json.Unmarshal(rec.Body.Bytes(), resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Response == nil || resp.Response.UID != "uid" || !resp.Response.Allowed {
+		t.Fatalf("expected the pod to be allowed, got %+v", resp.Response)
+	}
+	return resp.Response
+}
+
+func testServer(t *testing.T, defaultConfig string, configPaths []string, nodes ...runtime.Object) *Server {
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	config, err := autoscaler.NewFileConfig(defaultConfig, configPaths, stopCh)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	return &Server{clientset: fake.NewSimpleClientset(nodes...), config: config}
+}
+
+func TestMutate(t *testing.T) {
+	s := testServer(t, testConfig, nil, testNode("small", "2", "8Gi"), testNode("large", "64", "256Gi"))
+
+	testCases := []struct {
+		name        string
+		pod         *apiv1.Pod
+		expPatch    string
+		expWarnings int
+	}{
+		{
+			"small node",
+			testPod("DaemonSet", "small"),
+			`[{"op":"add","path":"/spec/containers/1/resources","value":{"limits":{"memory":"1Gi"},"requests":{"cpu":"150m","memory":"120Mi"}}}]`,
+			0,
+		},
+		{
+			"large node",
+			testPod("DaemonSet", "large"),
+			`[{"op":"add","path":"/spec/containers/1/resources","value":{"limits":{"memory":"1Gi"},"requests":{"cpu":"900m","memory":"740Mi"}}}]`,
+			0,
+		},
+		{
+			"not a daemonset",
+			testPod("ReplicaSet", "small"),
+			"",
+			0,
+		},
+		{
+			"unknown node",
+			testPod("DaemonSet", "missing"),
+			"",
+			1,
+		},
+	}
+
+	for _, tc := range testCases {
+		resp := review(t, s, tc.pod)
+		if string(resp.Patch) != tc.expPatch {
+			t.Errorf("%s: expected patch %s, got %s", tc.name, tc.expPatch, resp.Patch)
+		}
+		if len(resp.Warnings) != tc.expWarnings {
+			t.Errorf("%s: expected %d warnings, got %v", tc.name, tc.expWarnings, resp.Warnings)
+		}
+	}
+}
+
+func TestMutateKeepsLastGoodConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, []byte(testConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := testServer(t, "", []string{path}, testNode("small", "2", "8Gi"))
+	if err := os.WriteFile(path, []byte(`{"agent":{"requests":{"cpu":{"base":"x"}}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	resp := review(t, s, testPod("DaemonSet", "small"))
+	if len(resp.Warnings) != 0 || resp.Patch == nil {
+		t.Errorf("expected the last good config to be used, got warnings %v", resp.Warnings)
+	}
+}
+
+func TestServeHTTPLimitsBodySize(t *testing.T) {
+	s := testServer(t, testConfig, nil)
+	body := bytes.Repeat([]byte(" "), maxReviewSize+1)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("POST", MutatePath, bytes.NewReader(body)))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status %d, got %d", http.StatusRequestEntityTooLarge, rec.Code)
+	}
+}